@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/go-github/v38/github"
 )
 
 // AppsTransport provides a http.RoundTripper by wrapping an existing
@@ -20,11 +23,13 @@ import (
 //
 // See https://developer.github.com/apps/building-integrations/setting-up-and-registering-github-apps/about-authentication-options-for-github-apps/
 type AppsTransport struct {
-	BaseURL string            // BaseURL is the scheme and host for GitHub API, defaults to https://api.github.com
-	Client  Client            // Client to use to refresh tokens, defaults to http.Client with provided transport
-	tr      http.RoundTripper // tr is the underlying roundtripper being wrapped
-	key     *rsa.PrivateKey   // key is the GitHub App's private key
-	appID   int64             // appID is the GitHub App's ID
+	BaseURL          string            // BaseURL is the scheme and host for GitHub API, defaults to https://api.github.com
+	Client           Client            // Client to use to refresh tokens, defaults to http.Client with provided transport
+	AccessTokensURL  string            // AccessTokensURL overrides the URL to mint tokens from, "{id}" is replaced by the installation ID, defaults to BaseURL's
+	AcceptHeaderMode AcceptHeaderMode  // AcceptHeaderMode controls how requests' Accept header is set, defaults to adding GitHub's media type
+	tr               http.RoundTripper // tr is the underlying roundtripper being wrapped
+	key              *rsa.PrivateKey   // key is the GitHub App's private key
+	appID            int64             // appID is the GitHub App's ID
 }
 
 // NewAppsTransportKeyFromFile returns a AppsTransport using a private key from file.
@@ -37,16 +42,17 @@ func NewAppsTransportKeyFromFile(tr http.RoundTripper, appID int64, privateKeyFi
 }
 
 // NewAppsTransport returns a AppsTransport using private key. The key is parsed
-// and if any errors occur the error is non-nil.
+// and if any errors occur the error is non-nil, wrapping a *KeyError if the key
+// is unusable.
 //
 // The provided tr http.RoundTripper should be shared between multiple
 // installations to ensure reuse of underlying TCP connections.
 //
 // The returned Transport's RoundTrip method is safe to be used concurrently.
 func NewAppsTransport(tr http.RoundTripper, appID int64, privateKey []byte) (*AppsTransport, error) {
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(privateKey)
+	key, err := parsePrivateKey(privateKey)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse private key: %s", err)
+		return nil, fmt.Errorf("could not parse private key: %w", err)
 	}
 	return NewAppsTransportFromPrivateKey(tr, appID, key), nil
 }
@@ -62,8 +68,78 @@ func NewAppsTransportFromPrivateKey(tr http.RoundTripper, appID int64, key *rsa.
 	}
 }
 
+// NewAppsClient returns a github.Client authenticated as the GitHub App using
+// atr, for use with endpoints such as /app and /app/installations. Requests are
+// made relative to atr's BaseURL, in the same way as Transport.
+func NewAppsClient(atr *AppsTransport) (*github.Client, error) {
+	return newGitHubClient(atr.BaseURL, atr)
+}
+
+// newGitHubClient returns a github.Client sending requests relative to baseURL
+// using rt. GitHub Enterprise Server's API is at /api/v3/, with uploads, such
+// as release assets, at /api/uploads/.
+func newGitHubClient(baseURL string, rt http.RoundTripper) (*github.Client, error) {
+	httpClient := &http.Client{Transport: rt}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	if baseURL == apiBaseURL+"/" {
+		return github.NewClient(httpClient), nil
+	}
+	if strings.HasSuffix(baseURL, "/api/v3/") {
+		client, err := github.NewEnterpriseClient(baseURL, strings.TrimSuffix(baseURL, "v3/")+"uploads/", httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse base url: %s", err)
+		}
+		return client, nil
+	}
+
+	// Other servers, such as proxies, serve uploads relative to baseURL.
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse base url: %s", err)
+	}
+	client := github.NewClient(httpClient)
+	client.BaseURL = u
+	client.UploadURL = u
+	return client, nil
+}
+
+// CloseIdleConnections closes idle connections of the underlying
+// http.RoundTripper and Client, if they support it, such as when shutting
+// down. It's called by http.Client's CloseIdleConnections.
+func (t *AppsTransport) CloseIdleConnections() {
+	closeIdleConnections(t.tr)
+	closeIdleConnections(t.Client)
+}
+
 // RoundTrip implements http.RoundTripper interface.
+//
+// Requests following a redirect to a different host than the original
+// request are sent without the JWT.
 func (t *AppsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isCrossHostRedirect(req) {
+		req.Header.Del("Authorization")
+	} else if err := t.authenticate(req); err != nil {
+		return nil, err
+	}
+	setAcceptHeader(req.Header, t.AcceptHeaderMode)
+
+	resp, err := t.tr.RoundTrip(req)
+	return resp, err
+}
+
+// do sends req authenticated as the GitHub App using client, such as one
+// providing retry logic.
+func (t *AppsTransport) do(client Client, req *http.Request) (*http.Response, error) {
+	if err := t.authenticate(req); err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// authenticate sets req's Authorization header to a newly signed JWT.
+func (t *AppsTransport) authenticate(req *http.Request) error {
 	// GitHub rejects expiry and issue timestamps that are not an integer,
 	// while the jwt-go library serializes to fractional timestamps.
 	// Truncate them before passing to jwt-go.
@@ -78,12 +154,9 @@ func (t *AppsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	ss, err := bearer.SignedString(t.key)
 	if err != nil {
-		return nil, fmt.Errorf("could not sign jwt: %s", err)
+		return fmt.Errorf("could not sign jwt: %s", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+ss)
-	req.Header.Add("Accept", acceptHeader)
-
-	resp, err := t.tr.RoundTrip(req)
-	return resp, err
+	return nil
 }
@@ -2,6 +2,8 @@ package ghinstallation
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -102,3 +104,60 @@ func TestJWTExpiry(t *testing.T) {
 		t.Fatalf("error calling RoundTrip: %v", err)
 	}
 }
+
+func TestNewAppsClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.RequestURI != "/api/v3/app" {
+			t.Fatalf("unexpected URI: %q", r.RequestURI)
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			t.Errorf("Authorization got: %q want bearer token", r.Header.Get("Authorization"))
+		}
+		fmt.Fprintln(w, `{"slug": "my-app"}`)
+	}))
+	defer ts.Close()
+
+	tr, err := NewAppsTransport(&http.Transport{}, appID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	tr.BaseURL = ts.URL + "/api/v3"
+
+	client, err := NewAppsClient(tr)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	app, _, err := client.Apps.Get(context.Background(), "")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got, want := app.GetSlug(), "my-app"; got != want {
+		t.Errorf("app slug = %q, want %q", got, want)
+	}
+}
+
+func TestNewGitHubClient(t *testing.T) {
+	tests := []struct {
+		baseURL    string
+		wantBase   string
+		wantUpload string
+	}{
+		{"https://api.github.com", "https://api.github.com/", "https://uploads.github.com/"},
+		{"https://api.github.com/", "https://api.github.com/", "https://uploads.github.com/"},
+		{"https://github.example.com/api/v3", "https://github.example.com/api/v3/", "https://github.example.com/api/uploads/"},
+		{"https://github.example.com/api/v3/", "https://github.example.com/api/v3/", "https://github.example.com/api/uploads/"},
+		{"https://proxy.example.com/github", "https://proxy.example.com/github/", "https://proxy.example.com/github/"},
+	}
+	for _, test := range tests {
+		client, err := newGitHubClient(test.baseURL, http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("newGitHubClient(%q) unexpected error: %v", test.baseURL, err)
+		}
+		if got := client.BaseURL.String(); got != test.wantBase {
+			t.Errorf("newGitHubClient(%q) BaseURL = %q, want %q", test.baseURL, got, test.wantBase)
+		}
+		if got := client.UploadURL.String(); got != test.wantUpload {
+			t.Errorf("newGitHubClient(%q) UploadURL = %q, want %q", test.baseURL, got, test.wantUpload)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package ghinstallation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v38/github"
+)
+
+// maxBrokerRequest is the most of a request's body read by NewBrokerHandler,
+// token options are far smaller.
+const maxBrokerRequest = 1 << 20
+
+// BrokerAuthorizeFunc decides whether the client making r may obtain a token
+// for the installation, restricted by opts, which may be nil. It returns the
+// options to restrict the token by, allowing them to be narrowed to what the
+// client is allowed, or an error if the client isn't allowed a token.
+type BrokerAuthorizeFunc func(r *http.Request, installationID int64, opts *github.InstallationTokenOptions) (*github.InstallationTokenOptions, error)
+
+// ErrBrokerUnauthorized can be returned by a BrokerAuthorizeFunc when the
+// client could not be authenticated, resulting in a 401 response rather than
+// 403.
+var ErrBrokerUnauthorized = errors.New("client is not authenticated")
+
+// NewBrokerHandler returns an http.Handler serving tokens from ts to clients
+// allowed by authorize, implementing the protocol NewBrokerTokenSource
+// expects. Tokens are requested by POSTing the token options as JSON to a
+// path ending in "/installations/{id}/access_tokens", so the handler can be
+// mounted under any prefix.
+//
+// If ts fails with an *HTTPError for a client error from GitHub, such as 404
+// for an unknown installation or 422 for invalid token options, its status is
+// returned so NewBrokerTokenSource doesn't retry it. Other failures respond
+// with 502 Bad Gateway.
+//
+// ts should reuse tokens, such as one returned by ReuseTokenSource. If
+// authorize is nil, every request is forbidden.
+func NewBrokerHandler(ts TokenSource, authorize BrokerAuthorizeFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		installationID, ok := brokerInstallationID(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		var opts *github.InstallationTokenOptions
+		r.Body = http.MaxBytesReader(w, r.Body, maxBrokerRequest)
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && err != io.EOF {
+			http.Error(w, fmt.Sprintf("could not decode token options: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if authorize == nil {
+			http.Error(w, "no clients are authorized", http.StatusForbidden)
+			return
+		}
+		opts, err := authorize(r, installationID, opts)
+		if errors.Is(err, ErrBrokerUnauthorized) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		token, err := ts.Token(r.Context(), installationID, opts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not obtain token: %s", err), brokerErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(token)
+	})
+}
+
+// brokerErrorStatus returns the status to respond with when obtaining a token
+// failed with err. Client errors from GitHub, such as 404 for an unknown
+// installation or 422 for invalid token options, are passed through so the
+// client doesn't retry them, except 401 and 403 which are caused by the
+// broker's own credentials. Other errors respond with 502 Bad Gateway.
+func brokerErrorStatus(err error) int {
+	var e *HTTPError
+	if !errors.As(err, &e) || e.Response == nil {
+		return http.StatusBadGateway
+	}
+	code := e.Response.StatusCode
+	if code/100 == 4 && code != http.StatusUnauthorized && code != http.StatusForbidden {
+		return code
+	}
+	return http.StatusBadGateway
+}
+
+// brokerInstallationID returns the installation ID from a path ending in
+// "/installations/{id}/access_tokens".
+func brokerInstallationID(path string) (int64, bool) {
+	parts := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	if len(parts) < 3 || parts[len(parts)-3] != "installations" || parts[len(parts)-1] != "access_tokens" {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(parts[len(parts)-2], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,126 @@
+package ghinstallation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v38/github"
+)
+
+func TestBrokerHandler(t *testing.T) {
+	var (
+		gotOpts *github.InstallationTokenOptions
+		calls   int
+	)
+	src := TokenSourceFunc(func(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+		gotOpts = opts
+		calls++
+		if installationID == 4 {
+			return nil, &HTTPError{Message: "installation not found", InstallationID: installationID, Response: &http.Response{StatusCode: http.StatusNotFound}}
+		}
+		return &AccessToken{
+			Token:     fmt.Sprintf("token-%d", installationID),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}, nil
+	})
+	restricted := &github.InstallationTokenOptions{RepositoryIDs: []int64{1234}}
+	authorize := func(r *http.Request, installationID int64, opts *github.InstallationTokenOptions) (*github.InstallationTokenOptions, error) {
+		switch {
+		case r.Header.Get("Authorization") != "Bearer secret":
+			return nil, ErrBrokerUnauthorized
+		case installationID == 3:
+			return nil, errors.New("installation not allowed")
+		}
+		return restricted, nil
+	}
+	ts := httptest.NewServer(NewBrokerHandler(src, authorize))
+	defer ts.Close()
+
+	client := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		req.Header.Set("Authorization", "Bearer secret")
+		return http.DefaultClient.Do(req)
+	})
+	broker := NewBrokerTokenSource(client, ts.URL+"/v1/installations/{id}/access_tokens")
+
+	got, err := broker.Token(context.Background(), installationID, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if want := fmt.Sprintf("token-%d", installationID); got.Token != want {
+		t.Errorf("Token() = %q, want %q", got.Token, want)
+	}
+	if diff := cmp.Diff(restricted, gotOpts); diff != "" {
+		t.Errorf("token options want->got: %s", diff)
+	}
+
+	tests := map[string]struct {
+		client Client
+		id     int64
+		want   int
+	}{
+		"unauthenticated": {client: http.DefaultClient, id: installationID, want: http.StatusUnauthorized},
+		"forbidden":       {client: client, id: 3, want: http.StatusForbidden},
+		"not found":       {client: client, id: 4, want: http.StatusNotFound},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls = 0
+			_, err := NewBrokerTokenSource(test.client, ts.URL+"/v1/installations/{id}/access_tokens").Token(context.Background(), test.id, nil)
+			var herr *HTTPError
+			if !errors.As(err, &herr) || herr.Response.StatusCode != test.want {
+				t.Errorf("Token() err = %v, want HTTPError with status %d", err, test.want)
+			}
+			if calls > 1 {
+				t.Errorf("token requested %v times, want no retries", calls)
+			}
+		})
+	}
+
+	// Token options are limited in size.
+	resp, err := http.Post(ts.URL+"/v1/installations/1/access_tokens", "application/json", strings.NewReader(`{"repositories":["`+strings.Repeat("r", maxBrokerRequest)+`"]}`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %v for oversized request, want %v", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	// Without an authorize func, no clients are allowed tokens.
+	rec := httptest.NewRecorder()
+	NewBrokerHandler(src, nil).ServeHTTP(rec, httptest.NewRequest("POST", "/installations/1/access_tokens", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("got status %v without authorize func, want %v", rec.Code, http.StatusForbidden)
+	}
+
+	if got := brokerErrorStatus(&HTTPError{Response: &http.Response{StatusCode: http.StatusUnauthorized}}); got != http.StatusBadGateway {
+		t.Errorf("status for the broker's credentials being rejected = %v, want %v", got, http.StatusBadGateway)
+	}
+	if got := brokerErrorStatus(errors.New("network error")); got != http.StatusBadGateway {
+		t.Errorf("status for network error = %v, want %v", got, http.StatusBadGateway)
+	}
+}
+
+func TestBrokerInstallationID(t *testing.T) {
+	tests := map[string]int64{
+		"/installations/1/access_tokens":         1,
+		"/app/installations/12/access_tokens/":   12,
+		"/installations/abc/access_tokens":       0,
+		"/installations/1/repositories":          0,
+		"/installations/-1/access_tokens":        0,
+		"/access_tokens":                         0,
+		"/prefix/installations/99/access_tokens": 99,
+	}
+	for path, want := range tests {
+		if got, _ := brokerInstallationID(path); got != want {
+			t.Errorf("brokerInstallationID(%q) = %d, want %d", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ghinstallation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v38/github"
+)
+
+const (
+	// brokerAttempts is the number of times a token is requested from a
+	// broker before giving up.
+	brokerAttempts = 3
+	// brokerRetryWait is how long to wait before the first retry, doubling
+	// for each subsequent retry.
+	brokerRetryWait = 500 * time.Millisecond
+)
+
+// NewBrokerTokenSource returns a TokenSource obtaining tokens from a token
+// broker, a service which holds the GitHub App's private key and mints tokens
+// on behalf of its clients, so the client process doesn't need the app's
+// credentials.
+//
+// The broker is expected to implement the same protocol as GitHub's access
+// tokens endpoint: tokens are requested by POSTing the token options as JSON
+// to url, with "{id}" replaced by the installation ID, such as
+// "https://broker.internal/installations/{id}/access_tokens". It responds with
+// the token as JSON. NewBrokerHandler implements a broker.
+//
+// client should authenticate requests to the broker, such as with TLS client
+// certificates. Tokens are reused until they're about to expire, and requests
+// failing due to transient network errors or 429 and 5xx responses are
+// retried.
+func NewBrokerTokenSource(client Client, url string) TokenSource {
+	return ReuseTokenSource(&brokerTokenSource{client: client, url: url})
+}
+
+type brokerTokenSource struct {
+	client Client
+	url    string
+}
+
+// Token implements TokenSource.
+func (s *brokerTokenSource) Token(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+	u := accessTokensURL("", s.url, installationID)
+	wait := brokerRetryWait
+	for attempt := 1; ; attempt++ {
+		token, err := mintToken(ctx, s.client, nil, u, installationID, opts)
+		if err == nil || attempt == brokerAttempts || !retryableBrokerError(err) {
+			return token, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// retryableBrokerError returns whether the broker may succeed if the request
+// which failed with err is retried. Network errors have already been retried
+// by mintToken.
+func retryableBrokerError(err error) bool {
+	var e *HTTPError
+	if !errors.As(err, &e) || e.Response == nil {
+		return false
+	}
+	return e.Response.StatusCode == http.StatusTooManyRequests || e.Response.StatusCode/100 == 5
+}
@@ -0,0 +1,74 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v38/github"
+)
+
+func TestBrokerTokenSource(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.RequestURI != fmt.Sprintf("/installations/%d/access_tokens", installationID) {
+			t.Fatalf("unexpected URI: %q", r.RequestURI)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Authorization got: %q want none", r.Header.Get("Authorization"))
+		}
+		var opts github.InstallationTokenOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil || len(opts.RepositoryIDs) != 1 {
+			t.Errorf("unexpected token options %+v: %v", opts, err)
+		}
+
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(AccessToken{
+			Token:     token,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+	}))
+	defer ts.Close()
+
+	src := NewBrokerTokenSource(http.DefaultClient, ts.URL+"/installations/{id}/access_tokens")
+	opts := &github.InstallationTokenOptions{RepositoryIDs: []int64{1234}}
+	for i := 0; i < 2; i++ {
+		got, err := src.Token(context.Background(), installationID, opts)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if got.Token != token {
+			t.Errorf("Token() = %q, want %q", got.Token, token)
+		}
+	}
+
+	// The failed request was retried and the token reused.
+	if requests != 2 {
+		t.Errorf("broker received %d requests, want 2", requests)
+	}
+}
+
+func TestBrokerTokenSourceClientError(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	src := NewBrokerTokenSource(http.DefaultClient, ts.URL+"/installations/{id}/access_tokens")
+	if _, err := src.Token(context.Background(), installationID, nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if requests != 1 {
+		t.Errorf("broker received %d requests, want 1", requests)
+	}
+}
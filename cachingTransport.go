@@ -0,0 +1,350 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedBody is the largest response body CachingTransport stores.
+const maxCachedBody = 1 << 20
+
+// ResponseCache stores HTTP responses for CachingTransport.
+//
+// Implementations must be safe for concurrent use.
+type ResponseCache interface {
+	// Get returns the response stored under key, or nil if there's none.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores the response under key.
+	Set(ctx context.Context, key string, resp []byte) error
+	// Delete removes the response stored under key, if any.
+	Delete(ctx context.Context, key string) error
+}
+
+// CachingTransport is a private HTTP cache honoring the Cache-Control, ETag,
+// Last-Modified and Vary headers of responses, such as those returned by
+// GitHub's API. Fresh responses are returned without a request, and stale
+// responses are revalidated using conditional requests, which GitHub doesn't
+// count against the rate limit.
+//
+// CachingTransport should be wrapped by Transport, and may be shared by the
+// Transports of many installations:
+//
+//	ctr := ghinstallation.NewCachingTransport(http.DefaultTransport, nil)
+//	itr, err := ghinstallation.NewKeyFromFile(ctr, 1, 99, "2016-10-19.private-key.pem")
+//
+// Responses are cached per Authorization header, so they're only returned to
+// requests using the same token. As installation tokens are refreshed about
+// hourly, responses cached using the previous token, including their ETags,
+// are no longer used after a refresh and are evicted as the cache fills.
+// Requests with unsafe methods only invalidate responses cached for their own
+// token.
+//
+// Requests authenticated as a GitHub App using a JWT, such as by an
+// AppsTransport, aren't cached, as each JWT is only used for a few minutes.
+//
+// Only GET requests are cached. Responses served from the cache have the
+// X-From-Cache header set. Errors from the ResponseCache are treated as cache
+// misses rather than failing requests.
+type CachingTransport struct {
+	Cache ResponseCache // Cache stores the responses
+	tr    http.RoundTripper
+}
+
+var _ http.RoundTripper = &CachingTransport{}
+
+// NewCachingTransport returns a CachingTransport caching responses from tr in
+// cache, or in a NewMemoryResponseCache of 1000 responses if cache is nil.
+func NewCachingTransport(tr http.RoundTripper, cache ResponseCache) *CachingTransport {
+	if cache == nil {
+		cache = NewMemoryResponseCache(1000)
+	}
+	return &CachingTransport{Cache: cache, tr: tr}
+}
+
+// cachedResponse is the format responses are stored in.
+type cachedResponse struct {
+	StatusCode   int               `json:"status_code"`
+	Header       http.Header       `json:"header"`
+	Body         []byte            `json:"body"`
+	Vary         map[string]string `json:"vary,omitempty"` // Vary are hashes of the request headers named by the response's Vary header
+	ResponseTime time.Time         `json:"response_time"`  // ResponseTime is when the response was received or last revalidated
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ") {
+		// JWTs are replaced every few minutes, so their responses would only
+		// evict others.
+		return t.tr.RoundTrip(req)
+	}
+
+	// Responses are cached per credentials, so they're never shared between
+	// installations even if the server doesn't send Vary: Authorization.
+	key := "ghinstallation:response:" + varyHash(req, "Authorization") + ":" + req.URL.String()
+	reqCC := parseCacheControl(req.Header)
+
+	if req.Method != "GET" && req.Method != "HEAD" {
+		resp, err := t.tr.RoundTrip(req)
+		if err == nil && resp.StatusCode < 400 {
+			// Unsafe methods invalidate the cached resource.
+			t.Cache.Delete(req.Context(), key)
+		}
+		return resp, err
+	}
+	if req.Method != "GET" || reqCC.has("no-store") || req.Header.Get("Range") != "" {
+		return t.tr.RoundTrip(req)
+	}
+
+	cached := t.get(req, key)
+	if cached != nil {
+		cc := parseCacheControl(cached.Header)
+		if !reqCC.has("no-cache") && !cc.has("no-cache") && time.Since(cached.ResponseTime) < cc.maxAge() {
+			return cached.response(req), nil
+		}
+
+		etag, lastModified := cached.Header.Get("ETag"), cached.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			req = cloneRequest(req)
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				req.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+
+	resp, err := t.tr.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		closeBody(resp.Body)
+		for k, v := range resp.Header {
+			cached.Header[k] = v
+		}
+		cached.ResponseTime = time.Now()
+		t.set(req, key, cached)
+		return cached.response(req), nil
+	}
+
+	cc := parseCacheControl(resp.Header)
+	if resp.StatusCode != http.StatusOK || cc.has("no-store") || resp.Header.Get("Vary") == "*" {
+		return resp, nil
+	}
+	if cc.maxAge() == 0 && resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCachedBody+1))
+	if err != nil || len(body) > maxCachedBody {
+		// Too large or unreadable, return it uncached with the part that was
+		// read.
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	closeBody(resp.Body)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	t.set(req, key, &cachedResponse{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		Body:         body,
+		ResponseTime: time.Now(),
+	})
+	return resp, nil
+}
+
+// CloseIdleConnections closes idle connections of the underlying
+// http.RoundTripper, if it supports it.
+func (t *CachingTransport) CloseIdleConnections() {
+	closeIdleConnections(t.tr)
+}
+
+// get returns the response cached for req, or nil if there's none or it was
+// cached for a request with different Vary headers.
+func (t *CachingTransport) get(req *http.Request, key string) *cachedResponse {
+	b, err := t.Cache.Get(req.Context(), key)
+	if err != nil || b == nil {
+		return nil
+	}
+	var cached cachedResponse
+	if err := json.Unmarshal(b, &cached); err != nil {
+		return nil
+	}
+	for name, hash := range cached.Vary {
+		if varyHash(req, name) != hash {
+			return nil
+		}
+	}
+	return &cached
+}
+
+func (t *CachingTransport) set(req *http.Request, key string, cached *cachedResponse) {
+	cached.Vary = make(map[string]string)
+	for _, v := range cached.Header["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = http.CanonicalHeaderKey(strings.TrimSpace(name)); name != "" {
+				cached.Vary[name] = varyHash(req, name)
+			}
+		}
+	}
+	if b, err := json.Marshal(cached); err == nil {
+		t.Cache.Set(req.Context(), key, b)
+	}
+}
+
+// varyHash hashes req's header values, so credentials in headers such as
+// Authorization aren't stored in the cache.
+func varyHash(req *http.Request, name string) string {
+	sum := sha256.Sum256([]byte(strings.Join(req.Header[http.CanonicalHeaderKey(name)], "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// response returns the cached response to req.
+func (c *cachedResponse) response(req *http.Request) *http.Response {
+	header := make(http.Header, len(c.Header)+1)
+	for k, v := range c.Header {
+		header[k] = v
+	}
+	header.Set("X-From-Cache", "1")
+	return &http.Response{
+		Status:        strconv.Itoa(c.StatusCode) + " " + http.StatusText(c.StatusCode),
+		StatusCode:    c.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// cacheControl are the directives of a Cache-Control header.
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, v := range h["Cache-Control"] {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, value := directive, ""
+			if i := strings.Index(directive, "="); i >= 0 {
+				name, value = directive[:i], strings.Trim(directive[i+1:], `"`)
+			}
+			cc[strings.ToLower(name)] = value
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// maxAge returns how long a response is fresh for, or 0 if it's not.
+func (cc cacheControl) maxAge() time.Duration {
+	seconds, err := strconv.ParseInt(cc["max-age"], 10, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// cloneRequest returns a copy of req with its own headers, as RoundTrippers
+// must not modify requests.
+func cloneRequest(req *http.Request) *http.Request {
+	clone := new(http.Request)
+	*clone = *req
+	clone.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		clone.Header[k] = append([]string(nil), v...)
+	}
+	return clone
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// NewMemoryResponseCache returns a ResponseCache storing up to size responses
+// in memory, evicting the least recently used.
+func NewMemoryResponseCache(size int) ResponseCache {
+	return &memoryResponseCache{
+		size:      size,
+		order:     list.New(),
+		responses: make(map[string]*list.Element),
+	}
+}
+
+type memoryResponseCache struct {
+	size int
+
+	mu        sync.Mutex               // mu protects order and responses
+	order     *list.List               // order of keys from most to least recently used
+	responses map[string]*list.Element // responses are memoryResponses by key
+}
+
+type memoryResponse struct {
+	key  string
+	resp []byte
+}
+
+// Get implements ResponseCache.
+func (c *memoryResponseCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.responses[key]
+	if !ok {
+		return nil, nil
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*memoryResponse).resp, nil
+}
+
+// Set implements ResponseCache.
+func (c *memoryResponseCache) Set(ctx context.Context, key string, resp []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.responses[key]; ok {
+		e.Value.(*memoryResponse).resp = resp
+		c.order.MoveToFront(e)
+		return nil
+	}
+	c.responses[key] = c.order.PushFront(&memoryResponse{key: key, resp: resp})
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.responses, e.Value.(*memoryResponse).key)
+	}
+	return nil
+}
+
+// Delete implements ResponseCache.
+func (c *memoryResponseCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.responses[key]; ok {
+		c.order.Remove(e)
+		delete(c.responses, key)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package ghinstallation
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCachingTransport(t *testing.T) {
+	var requests int
+	cacheControl := "private, max-age=60"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Vary", "Accept, Authorization")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, "response %v", requests)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewCachingTransport(http.DefaultTransport, nil)}
+	get := func(authorization string) (string, bool) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", ts.URL+"/repos/o/r", nil)
+		req.Header.Set("Authorization", authorization)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return string(b), resp.Header.Get("X-From-Cache") != ""
+	}
+
+	if body, cached := get("token a"); body != "response 1" || cached {
+		t.Errorf("got %q cached %v, want first response uncached", body, cached)
+	}
+	if body, cached := get("token a"); body != "response 1" || !cached || requests != 1 {
+		t.Errorf("got %q cached %v after %v requests, want fresh response from cache", body, cached, requests)
+	}
+	if body, cached := get("token b"); body != "response 2" || cached {
+		t.Errorf("got %q cached %v, want response varying by Authorization", body, cached)
+	}
+
+	cacheControl = "private, max-age=0"
+	get("token c")
+	if body, cached := get("token c"); body != "response 3" || !cached || requests != 4 {
+		t.Errorf("got %q cached %v after %v requests, want revalidated response from cache", body, cached, requests)
+	}
+
+	cacheControl = "no-store"
+	get("token d")
+	if _, cached := get("token d"); cached {
+		t.Error("no-store response was cached")
+	}
+}
+
+func TestCachingTransportInvalidates(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			requests++
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewCachingTransport(http.DefaultTransport, nil)}
+	for _, method := range []string{"GET", "GET", "PATCH", "GET"} {
+		req, _ := http.NewRequest(method, ts.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		resp.Body.Close()
+	}
+	if requests != 2 {
+		t.Errorf("got %v GET requests, want 2", requests)
+	}
+}
+
+func TestMemoryResponseCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryResponseCache(2)
+	c.Set(ctx, "a", []byte("a"))
+	c.Set(ctx, "b", []byte("b"))
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("c"))
+
+	for key, want := range map[string]string{"a": "a", "b": "", "c": "c"} {
+		got, err := c.Get(ctx, key)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if string(got) != want {
+			t.Errorf("Get(%q) got %q want %q", key, got, want)
+		}
+	}
+
+	c.Delete(ctx, "a")
+	if got, _ := c.Get(ctx, "a"); got != nil {
+		t.Errorf("Get after Delete got %q", got)
+	}
+}
+
+func TestCachingTransportBeneathTransport(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		w.Header().Set("Vary", "Authorization")
+	}))
+	defer ts.Close()
+
+	tr := NewFromAccessToken(NewCachingTransport(http.DefaultTransport, nil), installationID, &AccessToken{
+		Token:     token,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	client := &http.Client{Transport: tr}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		resp.Body.Close()
+	}
+	if requests != 1 {
+		t.Errorf("got %v requests, want 1", requests)
+	}
+}
+
+func TestCachingTransportIsolatesCredentials(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// No Vary header, such as from a proxy stripping it.
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewCachingTransport(http.DefaultTransport, nil)}
+	for _, authorization := range []string{"token a", "token b", "token a"} {
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		req.Header.Set("Authorization", authorization)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != authorization {
+			t.Errorf("request with %q got response for %q", authorization, b)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("got %v requests, want 2", requests)
+	}
+}
+
+func TestCachingTransportSkipsJWTs(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "private, max-age=60")
+	}))
+	defer ts.Close()
+
+	cache := NewMemoryResponseCache(10)
+	tr, err := NewAppsTransport(NewCachingTransport(http.DefaultTransport, cache), appID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	client := &http.Client{Transport: tr}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(ts.URL + "/app/installations")
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		resp.Body.Close()
+	}
+	if requests != 2 {
+		t.Errorf("got %v requests, want 2", requests)
+	}
+	if n := len(cache.(*memoryResponseCache).responses); n != 0 {
+		t.Errorf("got %v cached responses, want 0", n)
+	}
+}
@@ -0,0 +1,202 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Capability is a feature of GitHub's API which isn't supported by older
+// versions of GitHub Enterprise Server.
+type Capability string
+
+const (
+	// CapabilityAPIVersionHeader is support for selecting the REST API's
+	// version using the X-GitHub-Api-Version header, see
+	// Transport.APIVersion.
+	CapabilityAPIVersionHeader Capability = "X-GitHub-Api-Version header"
+)
+
+// capabilityVersions are the GitHub Enterprise Server versions which
+// introduced each Capability. Only capabilities whose minimum version is
+// documented are listed:
+//
+//   - CapabilityAPIVersionHeader: REST API versioning was introduced in
+//     GitHub Enterprise Server 3.9, per its release notes and the "API
+//     Versions" page of the enterprise-server@3.9 REST API docs.
+//
+// Token options, such as MintScopedToken's repository names and the
+// permissions in github.InstallationPermissions, aren't gated as they're
+// accepted by every GitHub Enterprise Server release GitHub supports, and
+// checking them would add a /meta request to the first mint for nothing.
+var capabilityVersions = map[Capability]string{
+	CapabilityAPIVersionHeader: "3.9",
+}
+
+// serverVersionRetry is how long a failure to fetch the server's version is
+// returned before it's fetched again.
+const serverVersionRetry = time.Minute
+
+// CapabilityError is returned when a feature isn't supported by the version
+// of GitHub Enterprise Server being used.
+type CapabilityError struct {
+	Capability Capability
+	Version    string // Version is the server's version
+	MinVersion string // MinVersion is the oldest version supporting Capability
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("%s is not supported by GitHub Enterprise Server %s, it requires %s or later", e.Capability, e.Version, e.MinVersion)
+}
+
+// ServerVersion returns the version of GitHub Enterprise Server the
+// Transport's BaseURL refers to, such as "3.9.2", or "" for github.com. The
+// version is fetched from the server's /meta endpoint on first use and then
+// cached, authenticating as the app if the Transport has its private key, or
+// otherwise as the installation. If the server doesn't report its version ""
+// is returned. If fetching the version fails, the error is returned for a
+// minute before it's fetched again.
+func (t *Transport) ServerVersion(ctx context.Context) (string, error) {
+	if isGitHubDotCom(t.BaseURL) {
+		return "", nil
+	}
+
+	t.versionMu.Lock()
+	version, err, fetchedAt := t.serverVersion, t.serverVersionErr, t.serverVersionAt
+	t.versionMu.Unlock()
+	if !fetchedAt.IsZero() && (err == nil || time.Since(fetchedAt) < serverVersionRetry) {
+		return version, err
+	}
+
+	// versionMu isn't held while fetching, as it may need to obtain a token,
+	// so concurrent first uses may each fetch the version.
+	version, err = t.fetchServerVersion(ctx)
+	if err != nil && ctx != nil && ctx.Err() != nil {
+		// Don't hold the caller's cancellation against later requests.
+		return "", err
+	}
+	t.versionMu.Lock()
+	t.serverVersion, t.serverVersionErr, t.serverVersionAt = version, err, time.Now()
+	t.versionMu.Unlock()
+	return version, err
+}
+
+// fetchServerVersion fetches the server's version from /meta. It must not be
+// called with t.mu held, as it may obtain an installation token.
+func (t *Transport) fetchServerVersion(ctx context.Context) (string, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(t.BaseURL, "/")+"/meta", nil)
+	if err != nil {
+		return "", fmt.Errorf("could not create request: %s", err)
+	}
+	req.Header.Set("Accept", acceptHeader)
+	if ctx != nil {
+		req = req.WithContext(ctx)
+	}
+
+	// Servers in private mode require /meta requests to be authenticated.
+	var resp *http.Response
+	if t.appsTransport != nil {
+		resp, err = t.appsTransport.do(t.Client, req)
+	} else {
+		var token *AccessToken
+		if token, err = t.accessToken(req.Context()); err != nil {
+			return "", fmt.Errorf("could not get server version: %w", err)
+		}
+		req.Header.Set("Authorization", "token "+token.Token)
+		resp, err = t.Client.Do(req)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not get server version: %s", err)
+	}
+	defer closeBody(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return "", &HTTPError{
+			Message:        fmt.Sprintf("received non 2xx response status %q when fetching %v", resp.Status, req.URL),
+			InstallationID: t.installationID,
+			Response:       resp,
+			body:           bufferBody(resp),
+		}
+	}
+
+	var meta struct {
+		InstalledVersion string `json:"installed_version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return "", fmt.Errorf("could not decode server meta: %s", err)
+	}
+	if meta.InstalledVersion == "" {
+		meta.InstalledVersion = resp.Header.Get("X-GitHub-Enterprise-Version")
+	}
+	return meta.InstalledVersion, nil
+}
+
+// CheckCapability returns a *CapabilityError if the GitHub Enterprise Server
+// the Transport's BaseURL refers to doesn't support the Capability. github.com
+// and servers not reporting their version are assumed to support all
+// capabilities. An error is also returned if the server's version couldn't
+// be fetched.
+func (t *Transport) CheckCapability(ctx context.Context, capability Capability) error {
+	minVersion, ok := capabilityVersions[capability]
+	if !ok {
+		return fmt.Errorf("unknown capability %q", capability)
+	}
+	version, err := t.ServerVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("could not check support for %s: %w", capability, err)
+	}
+	if version != "" && compareVersions(version, minVersion) < 0 {
+		return &CapabilityError{
+			Capability: capability,
+			Version:    version,
+			MinVersion: minVersion,
+		}
+	}
+	return nil
+}
+
+// requireCapability returns a *CapabilityError if the server is known not to
+// support the capability. If the server's version couldn't be fetched the
+// feature is used anyway, leaving the server to reject it, rather than
+// failing while /meta is unavailable.
+func (t *Transport) requireCapability(ctx context.Context, capability Capability) error {
+	var cerr *CapabilityError
+	if err := t.CheckCapability(ctx, capability); errors.As(err, &cerr) {
+		return err
+	}
+	return nil
+}
+
+// isGitHubDotCom returns whether baseURL refers to github.com's API.
+func isGitHubDotCom(baseURL string) bool {
+	u, err := url.Parse(baseURL)
+	return err == nil && u.Host == "api.github.com"
+}
+
+// compareVersions compares dotted versions such as "3.9.2", returning -1, 0
+// or 1 if a is older, the same as or newer than b. Missing or non-numeric
+// components are treated as 0.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
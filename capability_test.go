@@ -0,0 +1,169 @@
+package ghinstallation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTransportAPIVersion(t *testing.T) {
+	for _, test := range []struct {
+		version string
+		wantErr bool
+	}{
+		{"3.8.5", true},
+		{"3.9.0", false},
+		{"3.10.1", false},
+		{"", false},
+	} {
+		t.Run(test.version, func(t *testing.T) {
+			var metas int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v3/meta":
+					metas++
+					if got := r.Header.Get("Authorization"); got != "token "+token {
+						t.Errorf("meta request Authorization got %q", got)
+					}
+					fmt.Fprintf(w, `{"installed_version": %q}`, test.version)
+				case "/api/v3/repos/o/r":
+					if got := r.Header.Get("X-GitHub-Api-Version"); got != "2022-11-28" {
+						t.Errorf("X-GitHub-Api-Version got %q", got)
+					}
+				default:
+					t.Errorf("unexpected URI: %q", r.RequestURI)
+				}
+			}))
+			defer ts.Close()
+
+			tr := NewFromAccessToken(http.DefaultTransport, installationID, &AccessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)})
+			tr.BaseURL = ts.URL + "/api/v3"
+			tr.APIVersion = "2022-11-28"
+			client := &http.Client{Transport: tr}
+
+			for i := 0; i < 2; i++ {
+				resp, err := client.Get(tr.BaseURL + "/repos/o/r")
+				var cerr *CapabilityError
+				if test.wantErr {
+					if !errors.As(err, &cerr) || cerr.Version != test.version || cerr.MinVersion != "3.9" {
+						t.Fatalf("got error %v, want CapabilityError", err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal("unexpected error:", err)
+				}
+				resp.Body.Close()
+			}
+			if metas != 1 {
+				t.Errorf("got %v meta requests, want 1", metas)
+			}
+		})
+	}
+}
+
+func TestTransportAPIVersionMetaError(t *testing.T) {
+	var metas int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v3/meta" {
+			metas++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if got := r.Header.Get("X-GitHub-Api-Version"); got != "2022-11-28" {
+			t.Errorf("X-GitHub-Api-Version got %q", got)
+		}
+	}))
+	defer ts.Close()
+
+	tr := NewFromAccessToken(http.DefaultTransport, installationID, &AccessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)})
+	tr.BaseURL = ts.URL + "/api/v3"
+	tr.APIVersion = "2022-11-28"
+	client := &http.Client{Transport: tr}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(tr.BaseURL + "/repos/o/r")
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		resp.Body.Close()
+	}
+	if metas != 1 {
+		t.Errorf("got %v meta requests, want 1", metas)
+	}
+	if err := tr.CheckCapability(context.Background(), CapabilityAPIVersionHeader); err == nil {
+		t.Error("expected error checking capability")
+	}
+
+	tr.serverVersionAt = time.Now().Add(-serverVersionRetry)
+	tr.ServerVersion(context.Background())
+	if metas != 2 {
+		t.Errorf("got %v meta requests after %v, want 2", metas, serverVersionRetry)
+	}
+}
+
+func TestTransportAPIVersionRedirect(t *testing.T) {
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-GitHub-Api-Version"); got != "" {
+			t.Errorf("X-GitHub-Api-Version got %q on redirect", got)
+		}
+	}))
+	defer storage.Close()
+	var metas int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v3/meta" {
+			metas++
+			fmt.Fprint(w, `{"installed_version": "3.9.0"}`)
+			return
+		}
+		http.Redirect(w, r, storage.URL+"/archive", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	tr := NewFromAccessToken(http.DefaultTransport, installationID, &AccessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)})
+	tr.BaseURL = ts.URL + "/api/v3"
+	tr.APIVersion = "2022-11-28"
+	resp, err := (&http.Client{Transport: tr}).Get(tr.BaseURL + "/repos/o/r/tarball")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	resp.Body.Close()
+	if metas != 1 {
+		t.Errorf("got %v meta requests, want 1", metas)
+	}
+}
+
+func TestCheckCapabilityGitHubDotCom(t *testing.T) {
+	tr := NewFromAccessToken(http.DefaultTransport, installationID, &AccessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)})
+	tr.Client = ClientFunc(func(req *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected request to %v", req.URL)
+		return nil, errors.New("unexpected request")
+	})
+	if err := tr.CheckCapability(context.Background(), CapabilityAPIVersionHeader); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := tr.CheckCapability(context.Background(), "unknown"); err == nil {
+		t.Error("expected error for unknown capability")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"3.9", "3.9.0", 0},
+		{"3.8.12", "3.9", -1},
+		{"3.10.0", "3.9", 1},
+		{"4.0", "3.9", 1},
+	}
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
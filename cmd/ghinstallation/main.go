@@ -0,0 +1,202 @@
+// Command ghinstallation inspects and authenticates as a GitHub App's
+// installations.
+//
+// Usage:
+//
+//	ghinstallation installations list -app-id 1 -private-key key.pem [-format table|json]
+//	ghinstallation token -app-id 1 -private-key key.pem (-installation-id 99 | -repo owner/name)
+//	ghinstallation serve -config broker.json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v38/github"
+)
+
+const usage = `Usage: ghinstallation <command> [flags]
+
+Commands:
+  installations list  list the app's installations
+  token               mint an installation token
+  serve               run a token broker
+`
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "ghinstallation:", err)
+		os.Exit(1)
+	}
+}
+
+// errUsage is returned when the command line is invalid.
+var errUsage = errors.New("invalid usage, see ghinstallation -h")
+
+// run runs the command given by args, writing its output to w.
+func run(ctx context.Context, args []string, w io.Writer) error {
+	switch {
+	case len(args) >= 2 && args[0] == "installations" && args[1] == "list":
+		return installationsList(ctx, args[2:], w)
+	case len(args) >= 1 && args[0] == "token":
+		return token(ctx, args[1:], w)
+	case len(args) >= 1 && args[0] == "serve":
+		return serve(ctx, args[1:], w)
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return errUsage
+}
+
+// appFlags are the flags used to authenticate as the GitHub App.
+type appFlags struct {
+	appID      int64
+	privateKey string
+	baseURL    string
+}
+
+func (f *appFlags) register(fs *flag.FlagSet) {
+	fs.Int64Var(&f.appID, "app-id", 0, "GitHub App ID")
+	fs.StringVar(&f.privateKey, "private-key", "", "path to the GitHub App's private key")
+	fs.StringVar(&f.baseURL, "base-url", "https://api.github.com", "GitHub API base URL, such as https://github.example.com/api/v3 for GitHub Enterprise")
+}
+
+// appsTransport returns an AppsTransport authenticating as the GitHub App.
+func (f *appFlags) appsTransport() (*ghinstallation.AppsTransport, error) {
+	if f.appID == 0 || f.privateKey == "" {
+		return nil, errors.New("-app-id and -private-key are required")
+	}
+	atr, err := ghinstallation.NewAppsTransportKeyFromFile(http.DefaultTransport, f.appID, f.privateKey)
+	if err != nil {
+		return nil, err
+	}
+	atr.BaseURL = strings.TrimSuffix(f.baseURL, "/")
+	return atr, nil
+}
+
+// installation is an installation as output by installations list.
+type installation struct {
+	ID          int64             `json:"id"`
+	Account     string            `json:"account"`
+	Suspended   bool              `json:"suspended"`
+	Permissions map[string]string `json:"permissions"`
+}
+
+func installationsList(ctx context.Context, args []string, w io.Writer) error {
+	var app appFlags
+	fs := flag.NewFlagSet("installations list", flag.ContinueOnError)
+	app.register(fs)
+	format := fs.String("format", "table", "output format, table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	atr, err := app.appsTransport()
+	if err != nil {
+		return err
+	}
+
+	var installations []installation
+	atr.Installations(ctx)(func(i *github.Installation, ierr error) bool {
+		if ierr != nil {
+			err = ierr
+			return false
+		}
+		installations = append(installations, installation{
+			ID:          i.GetID(),
+			Account:     i.GetAccount().GetLogin(),
+			Suspended:   i.SuspendedAt != nil,
+			Permissions: permissions(i.GetPermissions()),
+		})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(installations)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tACCOUNT\tSUSPENDED\tPERMISSIONS")
+	for _, i := range installations {
+		var perms []string
+		for name, access := range i.Permissions {
+			perms = append(perms, name+":"+access)
+		}
+		sort.Strings(perms)
+		fmt.Fprintf(tw, "%d\t%s\t%t\t%s\n", i.ID, i.Account, i.Suspended, strings.Join(perms, ","))
+	}
+	return tw.Flush()
+}
+
+// token mints a token for an installation, either given by its ID or
+// discovered from a repository. Tokens for a repository are restricted to it.
+func token(ctx context.Context, args []string, w io.Writer) error {
+	var app appFlags
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	app.register(fs)
+	installationID := fs.Int64("installation-id", 0, "installation ID to mint a token for")
+	repo := fs.String("repo", "", "repository, as owner/name, to find the installation of and restrict the token to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*installationID == 0) == (*repo == "") {
+		return errors.New("one of -installation-id or -repo is required")
+	}
+
+	atr, err := app.appsTransport()
+	if err != nil {
+		return err
+	}
+
+	if *installationID != 0 {
+		tok, err := ghinstallation.NewFromAppsTransport(atr, *installationID).Token(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, tok)
+		return err
+	}
+
+	parts := strings.Split(*repo, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid repository %q, must be owner/name", *repo)
+	}
+	installation, err := atr.FindRepositoryInstallation(ctx, parts[0], parts[1])
+	if err != nil {
+		return err
+	}
+	tok, err := ghinstallation.NewFromAppsTransport(atr, installation.GetID()).MintScopedToken(ctx, []string{parts[1]}, nil)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, tok.Token)
+	return err
+}
+
+// permissions returns the permissions granted by perms, by name.
+func permissions(perms *github.InstallationPermissions) map[string]string {
+	m := make(map[string]string)
+	if perms == nil {
+		return m
+	}
+	b, _ := json.Marshal(perms)
+	json.Unmarshal(b, &m)
+	return m
+}
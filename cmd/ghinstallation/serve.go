@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v38/github"
+)
+
+// shutdownTimeout is how long in-flight requests are given to complete when
+// shutting down.
+const shutdownTimeout = 30 * time.Second
+
+// permissionLevels orders permission access levels.
+var permissionLevels = map[string]int{"read": 1, "write": 2, "admin": 3}
+
+// serveConfig is the configuration file of the serve command.
+type serveConfig struct {
+	Listen     string `json:"listen"`      // Listen is the address to listen on, such as ":8443"
+	AppID      int64  `json:"app_id"`      // AppID is the GitHub App ID
+	PrivateKey string `json:"private_key"` // PrivateKey is the path to the GitHub App's private key
+	BaseURL    string `json:"base_url"`    // BaseURL is the GitHub API base URL, defaults to https://api.github.com
+	Auth       string `json:"auth"`        // Auth is how clients authenticate, "mtls" or "token"
+	TLS        struct {
+		Cert     string `json:"cert"`      // Cert is the path to the server's certificate, required unless listening on a loopback address
+		Key      string `json:"key"`       // Key is the path to the server's private key
+		ClientCA string `json:"client_ca"` // ClientCA is the path to the CA certificates verifying clients, required for mtls
+	} `json:"tls"`
+	Clients []serveClient `json:"clients"`
+	Log     struct {
+		File       string `json:"file"`        // File to log to, defaults to stderr
+		MaxSizeMB  int64  `json:"max_size_mb"` // MaxSizeMB is the size File is rotated at, defaults to 100
+		MaxBackups int    `json:"max_backups"` // MaxBackups is the number of rotated files kept
+	} `json:"log"`
+}
+
+// serveClient is a client allowed to obtain tokens from the broker.
+type serveClient struct {
+	Name          string            `json:"name"`           // Name identifies the client, and must match its certificate's common name for mtls
+	Token         string            `json:"token"`          // Token is the client's bearer token for token auth
+	Installations []int64           `json:"installations"`  // Installations the client may obtain tokens for
+	Permissions   map[string]string `json:"permissions"`    // Permissions are the most the client's tokens may be granted, defaults to the installation's
+	RepositoryIDs []int64           `json:"repository_ids"` // RepositoryIDs are the repositories the client's tokens are restricted to, defaults to the installation's
+}
+
+// serve runs the token broker until it receives SIGINT or SIGTERM.
+func serve(ctx context.Context, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to the configuration file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *configFile == "" {
+		return errors.New("-config is required")
+	}
+	b, err := ioutil.ReadFile(*configFile)
+	if err != nil {
+		return fmt.Errorf("could not read config: %s", err)
+	}
+	var cfg serveConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return fmt.Errorf("could not parse config: %s", err)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	if cfg.Log.File != "" {
+		maxSize := cfg.Log.MaxSizeMB
+		if maxSize <= 0 {
+			maxSize = 100
+		}
+		f, err := newRotatingFile(cfg.Log.File, maxSize<<20, cfg.Log.MaxBackups)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		logger = log.New(f, "", log.LstdFlags)
+	}
+
+	srv, err := newBrokerServer(&cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case sig := <-signals:
+			logger.Printf("received %v, shutting down", sig)
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		logger.Printf("listening on %v", cfg.Listen)
+		if srv.TLSConfig != nil {
+			errs <- srv.ListenAndServeTLS(cfg.TLS.Cert, cfg.TLS.Key)
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// newBrokerServer returns a server for the token broker described by cfg.
+func newBrokerServer(cfg *serveConfig, logger *log.Logger) (*http.Server, error) {
+	if cfg.Listen == "" {
+		return nil, errors.New("listen address is required")
+	}
+	if cfg.Auth != "mtls" && cfg.Auth != "token" {
+		return nil, fmt.Errorf("unknown auth %q, must be mtls or token", cfg.Auth)
+	}
+	if (cfg.TLS.Cert == "") != (cfg.TLS.Key == "") {
+		return nil, errors.New("tls.cert and tls.key must both be set")
+	}
+	if cfg.Auth == "mtls" && cfg.TLS.Cert == "" {
+		return nil, errors.New("mtls auth requires tls.cert and tls.key")
+	}
+	if cfg.TLS.Cert == "" && !isLoopback(cfg.Listen) {
+		// Bearer tokens and the installation tokens returned would be sent
+		// in cleartext.
+		return nil, errors.New("token auth requires tls.cert and tls.key unless listening on a loopback address")
+	}
+
+	app := appFlags{appID: cfg.AppID, privateKey: cfg.PrivateKey, baseURL: cfg.BaseURL}
+	if app.baseURL == "" {
+		app.baseURL = "https://api.github.com"
+	}
+	atr, err := app.appsTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{
+		Addr:     cfg.Listen,
+		Handler:  ghinstallation.NewBrokerHandler(ghinstallation.ReuseTokenSource(atr), cfg.authorize(logger)),
+		ErrorLog: logger,
+	}
+	if cfg.TLS.Cert != "" {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.Auth == "mtls" {
+		b, err := ioutil.ReadFile(cfg.TLS.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("could not parse client CA")
+		}
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return srv, nil
+}
+
+// isLoopback returns whether the listen address only accepts connections
+// from the same host.
+func isLoopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// authorize returns a ghinstallation.BrokerAuthorizeFunc allowing the
+// configured clients their configured scopes, logging its decisions.
+func (cfg *serveConfig) authorize(logger *log.Logger) ghinstallation.BrokerAuthorizeFunc {
+	return func(r *http.Request, installationID int64, opts *github.InstallationTokenOptions) (*github.InstallationTokenOptions, error) {
+		client := cfg.client(r)
+		if client == nil {
+			logger.Printf("rejected unauthenticated client %v for installation %v", r.RemoteAddr, installationID)
+			return nil, ghinstallation.ErrBrokerUnauthorized
+		}
+		opts, err := client.restrict(installationID, opts)
+		if err != nil {
+			logger.Printf("rejected client %v for installation %v: %v", client.Name, installationID, err)
+			return nil, err
+		}
+		logger.Printf("issuing token to client %v for installation %v", client.Name, installationID)
+		return opts, nil
+	}
+}
+
+// client returns the configured client making r, or nil if there's none.
+func (cfg *serveConfig) client(r *http.Request) *serveClient {
+	for i := range cfg.Clients {
+		c := &cfg.Clients[i]
+		switch cfg.Auth {
+		case "mtls":
+			if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 && r.TLS.PeerCertificates[0].Subject.CommonName == c.Name {
+				return c
+			}
+		case "token":
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if c.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) == 1 {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// restrict returns the token options restricting the client's token for the
+// installation, or an error if the client may not obtain it.
+func (c *serveClient) restrict(installationID int64, opts *github.InstallationTokenOptions) (*github.InstallationTokenOptions, error) {
+	allowed := false
+	for _, id := range c.Installations {
+		allowed = allowed || id == installationID
+	}
+	if !allowed {
+		return nil, fmt.Errorf("installation %v is not allowed", installationID)
+	}
+
+	restricted := &github.InstallationTokenOptions{}
+	if opts != nil {
+		*restricted = *opts
+	}
+
+	if len(c.RepositoryIDs) > 0 {
+		if len(restricted.RepositoryIDs) == 0 {
+			restricted.RepositoryIDs = c.RepositoryIDs
+		}
+		for _, id := range restricted.RepositoryIDs {
+			allowed := false
+			for _, allowedID := range c.RepositoryIDs {
+				allowed = allowed || id == allowedID
+			}
+			if !allowed {
+				return nil, fmt.Errorf("repository %v is not allowed", id)
+			}
+		}
+	}
+
+	if len(c.Permissions) > 0 {
+		// An empty set of permissions would be forwarded to GitHub as no
+		// restriction at all, so it's treated the same as none.
+		if len(permissions(restricted.Permissions)) == 0 {
+			restricted.Permissions = nil
+			b, _ := json.Marshal(c.Permissions)
+			json.Unmarshal(b, &restricted.Permissions)
+		}
+		for name, access := range permissions(restricted.Permissions) {
+			if permissionLevels[access] > permissionLevels[c.Permissions[name]] {
+				return nil, fmt.Errorf("%v:%v permission is not allowed", name, access)
+			}
+		}
+	}
+
+	if restricted.Permissions == nil && len(restricted.RepositoryIDs) == 0 {
+		return nil, nil
+	}
+	return restricted, nil
+}
+
+// rotatingFile is a log file which is rotated once it reaches a size, keeping
+// a number of previous files suffixed with .1, .2 and so on.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex // mu protects f and size
+	f    *os.File
+	size int64
+}
+
+// newRotatingFile opens the file at path for appending, rotating it once it
+// reaches maxSize bytes.
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open log file: %s", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not stat log file: %s", err)
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write implements io.Writer, rotating the file first if p would exceed its
+// maximum size.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	if r.maxBackups == 0 {
+		os.Remove(r.path)
+	} else {
+		for i := r.maxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		os.Rename(r.path, r.path+".1")
+	}
+	return r.open()
+}
+
+// Close closes the file.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
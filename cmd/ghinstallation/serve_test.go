@@ -0,0 +1,187 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v38/github"
+)
+
+func TestRestrict(t *testing.T) {
+	client := &serveClient{
+		Installations: []int64{99},
+		Permissions:   map[string]string{"contents": "write", "issues": "read"},
+		RepositoryIDs: []int64{1, 2},
+	}
+
+	tests := []struct {
+		name           string
+		installationID int64
+		opts           *github.InstallationTokenOptions
+		want           *github.InstallationTokenOptions
+		wantErr        bool
+	}{
+		{
+			name:           "defaults",
+			installationID: 99,
+			want: &github.InstallationTokenOptions{
+				RepositoryIDs: []int64{1, 2},
+				Permissions: &github.InstallationPermissions{
+					Contents: github.String("write"),
+					Issues:   github.String("read"),
+				},
+			},
+		},
+		{
+			name:           "narrowed",
+			installationID: 99,
+			opts: &github.InstallationTokenOptions{
+				RepositoryIDs: []int64{2},
+				Permissions:   &github.InstallationPermissions{Contents: github.String("read")},
+			},
+			want: &github.InstallationTokenOptions{
+				RepositoryIDs: []int64{2},
+				Permissions:   &github.InstallationPermissions{Contents: github.String("read")},
+			},
+		},
+		{
+			name:           "empty permissions",
+			installationID: 99,
+			opts:           &github.InstallationTokenOptions{Permissions: &github.InstallationPermissions{}},
+			want: &github.InstallationTokenOptions{
+				RepositoryIDs: []int64{1, 2},
+				Permissions: &github.InstallationPermissions{
+					Contents: github.String("write"),
+					Issues:   github.String("read"),
+				},
+			},
+		},
+		{name: "installation", installationID: 100, wantErr: true},
+		{
+			name:           "repository",
+			installationID: 99,
+			opts:           &github.InstallationTokenOptions{RepositoryIDs: []int64{3}},
+			wantErr:        true,
+		},
+		{
+			name:           "escalated permission",
+			installationID: 99,
+			opts: &github.InstallationTokenOptions{
+				Permissions: &github.InstallationPermissions{Issues: github.String("write")},
+			},
+			wantErr: true,
+		},
+		{
+			name:           "unlisted permission",
+			installationID: 99,
+			opts: &github.InstallationTokenOptions{
+				Permissions: &github.InstallationPermissions{Administration: github.String("read")},
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := client.restrict(test.installationID, test.opts)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected options (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewBrokerServerRequiresTLS(t *testing.T) {
+	_, flags, cleanup := newTestServer(t)
+	defer cleanup()
+	privateKey := flags[3]
+
+	tests := []struct {
+		name         string
+		listen, auth string
+		cert, key    string
+		wantErr      bool
+	}{
+		{name: "token over loopback", listen: "127.0.0.1:8080", auth: "token"},
+		{name: "token over localhost", listen: "localhost:8080", auth: "token"},
+		{name: "token over network", listen: ":8080", auth: "token", wantErr: true},
+		{name: "mtls without cert", listen: "127.0.0.1:8443", auth: "mtls", wantErr: true},
+		{name: "cert without key", listen: ":8443", auth: "token", cert: "server.pem", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &serveConfig{Listen: test.listen, AppID: 1, PrivateKey: privateKey, Auth: test.auth}
+			cfg.TLS.Cert, cfg.TLS.Key = test.cert, test.key
+			_, err := newBrokerServer(cfg, log.New(ioutil.Discard, "", 0))
+			if (err != nil) != test.wantErr {
+				t.Errorf("newBrokerServer() err = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestServeClient(t *testing.T) {
+	cfg := &serveConfig{
+		Auth:    "token",
+		Clients: []serveClient{{Name: "ci", Token: "secret", Installations: []int64{99}}},
+	}
+	authorize := cfg.authorize(log.New(ioutil.Discard, "", 0))
+
+	r := httptest.NewRequest("POST", "/app/installations/99/access_tokens", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	if _, err := authorize(r, 99, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	r.Header.Set("Authorization", "Bearer wrong")
+	if _, err := authorize(r, 99, nil); err != ghinstallation.ErrBrokerUnauthorized {
+		t.Errorf("expected ErrBrokerUnauthorized, got %v", err)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghinstallation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+
+	f, err := newRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		got, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%v contains %q, want %q", file, got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups, got %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dynamoDBConditionalCheckFailed is the error type DynamoDB returns when a
+// conditional write's condition isn't met.
+const dynamoDBConditionalCheckFailed = "ConditionalCheckFailedException"
+
+// DynamoDBTokenCache is a TokenCache storing tokens in a DynamoDB table, such
+// as for AWS Lambda functions which would otherwise mint a token on every
+// cold start.
+//
+// The table must have a string partition key named "key". Enable DynamoDB's
+// TTL on the table's "expires_at" attribute so expired tokens are removed.
+type DynamoDBTokenCache struct {
+	Client      Client         // Client to send requests to DynamoDB with
+	Endpoint    string         // Endpoint is the scheme and host of DynamoDB, defaults to the region's endpoint
+	Region      string         // Region is the AWS region of the table
+	Table       string         // Table is the name of the table
+	Credentials AWSCredentials // Credentials to sign requests with
+}
+
+var _ TokenCache = &DynamoDBTokenCache{}
+
+// AWSCredentials are used to sign requests to AWS.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // SessionToken is required for temporary credentials
+}
+
+// AWSCredentialsFromEnv returns the credentials set in the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables, as
+// provided to AWS Lambda functions.
+func AWSCredentialsFromEnv() AWSCredentials {
+	return AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// NewDynamoDBTokenCache returns a DynamoDBTokenCache storing tokens in table
+// within region.
+func NewDynamoDBTokenCache(client Client, region, table string, creds AWSCredentials) *DynamoDBTokenCache {
+	return &DynamoDBTokenCache{
+		Client:      client,
+		Endpoint:    fmt.Sprintf("https://dynamodb.%s.amazonaws.com", region),
+		Region:      region,
+		Table:       table,
+		Credentials: creds,
+	}
+}
+
+// dynamoDBItem is a token's item in the table, in DynamoDB's attribute value
+// format.
+type dynamoDBItem struct {
+	Key struct {
+		S string
+	} `json:"key"`
+	Token struct {
+		S string
+	} `json:"token"`
+	ExpiresAt struct {
+		N string
+	} `json:"expires_at"`
+}
+
+// Get implements TokenCache. Tokens which have expired but not yet been
+// removed by DynamoDB are ignored.
+func (c *DynamoDBTokenCache) Get(ctx context.Context, key string) (*AccessToken, error) {
+	req := map[string]interface{}{
+		"TableName":      c.Table,
+		"Key":            map[string]interface{}{"key": map[string]string{"S": key}},
+		"ConsistentRead": true,
+	}
+	var resp struct {
+		Item *dynamoDBItem
+	}
+	if err := c.do(ctx, "GetItem", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Item == nil {
+		return nil, nil
+	}
+	if exp, _ := strconv.ParseInt(resp.Item.ExpiresAt.N, 10, 64); exp <= time.Now().Unix() {
+		return nil, nil
+	}
+
+	return UnmarshalAccessToken([]byte(resp.Item.Token.S))
+}
+
+// Set implements TokenCache. The token is only stored if there's no token
+// stored which expires after it, so concurrent writers can't replace a newer
+// token with an older one.
+func (c *DynamoDBTokenCache) Set(ctx context.Context, key string, token *AccessToken) error {
+	b, err := MarshalAccessToken(token)
+	if err != nil {
+		return fmt.Errorf("could not encode token: %s", err)
+	}
+	exp := strconv.FormatInt(token.ExpiresAt.Unix(), 10)
+
+	req := map[string]interface{}{
+		"TableName": c.Table,
+		"Item": map[string]interface{}{
+			"key":        map[string]string{"S": key},
+			"token":      map[string]string{"S": string(b)},
+			"expires_at": map[string]string{"N": exp},
+		},
+		"ConditionExpression":       "attribute_not_exists(#key) OR #expires_at < :expires_at",
+		"ExpressionAttributeNames":  map[string]string{"#key": "key", "#expires_at": "expires_at"},
+		"ExpressionAttributeValues": map[string]interface{}{":expires_at": map[string]string{"N": exp}},
+	}
+	err = c.do(ctx, "PutItem", req, nil)
+	if e, ok := err.(*dynamoDBError); ok && e.Type == dynamoDBConditionalCheckFailed {
+		// A token expiring later has already been stored.
+		return nil
+	}
+	return err
+}
+
+// dynamoDBError is an error response from DynamoDB.
+type dynamoDBError struct {
+	Type    string
+	Message string
+}
+
+func (e *dynamoDBError) Error() string {
+	return fmt.Sprintf("dynamodb error %s: %s", e.Type, e.Message)
+}
+
+// do sends body as a request for the DynamoDB operation, decoding the response
+// into v if it's non-nil.
+func (c *DynamoDBTokenCache) do(ctx context.Context, operation string, body, v interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("could not encode dynamodb request: %s", err)
+	}
+	req, err := http.NewRequest("POST", c.Endpoint+"/", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("could not create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "DynamoDB_20120810."+operation)
+	signAWSRequest(req, b, c.Credentials, c.Region, "dynamodb", time.Now())
+	req = req.WithContext(ctx)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send dynamodb %s request: %s", operation, err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		// Types are prefixed with a namespace, such as "com.amazonaws.dynamodb.v20120810#".
+		typ := e.Type[strings.LastIndex(e.Type, "#")+1:]
+		if typ == "" {
+			typ = resp.Status
+		}
+		return &dynamoDBError{Type: typ, Message: e.Message}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// signAWSRequest signs req, with the given body, using AWS Signature Version 4.
+func signAWSRequest(req *http.Request, body []byte, creds AWSCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Sign the Host header and all headers set on the request.
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalAWSQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalAWSQuery returns the query sorted and encoded as AWS Signature
+// Version 4 requires.
+func canonicalAWSQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsEscape percent encodes s as described by RFC 3986.
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
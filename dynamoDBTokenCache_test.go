@@ -0,0 +1,111 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignAWSRequest(t *testing.T) {
+	// Example from https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+	req, err := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := AWSCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	signAWSRequest(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization got: %q want: %q", got, want)
+	}
+}
+
+// fakeDynamoDB implements enough of DynamoDB for DynamoDBTokenCache.
+type fakeDynamoDB struct {
+	mu    sync.Mutex
+	items map[string]json.RawMessage
+}
+
+func (d *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var req struct {
+		Key  map[string]struct{ S string }
+		Item json.RawMessage
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	switch r.Header.Get("X-Amz-Target") {
+	case "DynamoDB_20120810.GetItem":
+		json.NewEncoder(w).Encode(map[string]json.RawMessage{"Item": d.items[req.Key["key"].S]})
+	case "DynamoDB_20120810.PutItem":
+		var item dynamoDBItem
+		json.Unmarshal(req.Item, &item)
+		if existing, ok := d.items[item.Key.S]; ok {
+			var e dynamoDBItem
+			json.Unmarshal(existing, &e)
+			if e.ExpiresAt.N >= item.ExpiresAt.N {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException","message":"The conditional request failed"}`))
+				return
+			}
+		}
+		d.items[item.Key.S] = req.Item
+		w.Write([]byte("{}"))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestDynamoDBTokenCache(t *testing.T) {
+	var authorized bool
+	db := &fakeDynamoDB{items: make(map[string]json.RawMessage)}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorized = strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/")
+		db.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	cache := NewDynamoDBTokenCache(http.DefaultClient, "us-east-1", "tokens", AWSCredentials{AccessKeyID: "AKIDEXAMPLE"})
+	cache.Endpoint = ts.URL
+	ctx := context.Background()
+
+	got, err := cache.Get(ctx, "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got != nil {
+		t.Fatalf("Get() = %v, want nil", got)
+	}
+	if !authorized {
+		t.Error("request was not signed")
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	if err := cache.Set(ctx, "key", &AccessToken{Token: token, ExpiresAt: expiresAt}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	// Older tokens don't replace newer ones.
+	if err := cache.Set(ctx, "key", &AccessToken{Token: "older", ExpiresAt: expiresAt.Add(-time.Minute)}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	got, err = cache.Get(ctx, "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got == nil || got.Token != token {
+		t.Fatalf("Get() = %v, want token %q", got, token)
+	}
+}
@@ -0,0 +1,186 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// etcdLockTTL is how long a refresh lock is held if its holder fails to
+	// release it, such as when the process exits.
+	etcdLockTTL = 30 * time.Second
+	// etcdLockRetry is how often a held refresh lock is retried.
+	etcdLockRetry = 100 * time.Millisecond
+)
+
+// EtcdTokenCache is a TokenCache storing tokens in etcd using the v3 API's
+// JSON gateway. Tokens are attached to leases, so etcd removes them once they
+// expire.
+type EtcdTokenCache struct {
+	Client      Client // Client to send requests to etcd with, configure its transport for TLS client authentication if required
+	Endpoint    string // Endpoint is the scheme and host of an etcd member, such as https://etcd:2379
+	Prefix      string // Prefix is prepended to keys
+	RefreshLock bool   // RefreshLock enables Lock, so only one process refreshes a token at a time
+}
+
+var (
+	_ TokenCache       = &EtcdTokenCache{}
+	_ TokenCacheLocker = &EtcdTokenCache{}
+)
+
+// NewEtcdTokenCache returns an EtcdTokenCache sending requests to the etcd
+// member at endpoint using client.
+func NewEtcdTokenCache(client Client, endpoint string) *EtcdTokenCache {
+	return &EtcdTokenCache{
+		Client:   client,
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Prefix:   "/ghinstallation/",
+	}
+}
+
+// etcdKeyValue is a key value pair in etcd, with base64 encoded keys and
+// values as used by the JSON gateway.
+type etcdKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value,omitempty"`
+	Lease int64  `json:"lease,omitempty,string"`
+}
+
+// Get implements TokenCache.
+func (c *EtcdTokenCache) Get(ctx context.Context, key string) (*AccessToken, error) {
+	var resp struct {
+		KVs []etcdKeyValue `json:"kvs"`
+	}
+	if err := c.do(ctx, "/v3/kv/range", etcdKeyValue{Key: []byte(c.Prefix + key)}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.KVs) == 0 {
+		return nil, nil
+	}
+
+	return UnmarshalAccessToken(resp.KVs[0].Value)
+}
+
+// Set implements TokenCache.
+func (c *EtcdTokenCache) Set(ctx context.Context, key string, token *AccessToken) error {
+	ttl := time.Until(token.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	b, err := MarshalAccessToken(token)
+	if err != nil {
+		return fmt.Errorf("could not encode token: %s", err)
+	}
+
+	lease, err := c.grant(ctx, ttl)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "/v3/kv/put", etcdKeyValue{Key: []byte(c.Prefix + key), Value: b, Lease: lease}, nil)
+}
+
+// errEtcdLockDisabled is returned by EtcdTokenCache.Lock if RefreshLock isn't
+// set, so CacheTokenSource doesn't read the cache again after locking.
+var errEtcdLockDisabled = errors.New("etcd refresh lock is disabled")
+
+// Lock implements TokenCacheLocker, if RefreshLock is set, otherwise it
+// returns an error. The lock is released after a while if it's never
+// unlocked.
+func (c *EtcdTokenCache) Lock(ctx context.Context, key string) (func(), error) {
+	if !c.RefreshLock {
+		return nil, errEtcdLockDisabled
+	}
+
+	lease, err := c.grant(ctx, etcdLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	unlock := func() {
+		// Revoking the lease deletes the lock.
+		c.do(context.Background(), "/v3/lease/revoke", struct {
+			ID int64 `json:"ID,string"`
+		}{lease}, nil)
+	}
+
+	lockKey := []byte(c.Prefix + "lock/" + key)
+	txn := map[string]interface{}{
+		"compare": []interface{}{map[string]interface{}{
+			"key":             lockKey,
+			"target":          "CREATE",
+			"result":          "EQUAL",
+			"create_revision": "0",
+		}},
+		"success": []interface{}{map[string]interface{}{
+			"request_put": etcdKeyValue{Key: lockKey, Value: []byte("locked"), Lease: lease},
+		}},
+	}
+	for {
+		var resp struct {
+			Succeeded bool `json:"succeeded"`
+		}
+		if err := c.do(ctx, "/v3/kv/txn", txn, &resp); err != nil {
+			unlock()
+			return nil, err
+		}
+		if resp.Succeeded {
+			return unlock, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			unlock()
+			return nil, ctx.Err()
+		case <-time.After(etcdLockRetry):
+		}
+	}
+}
+
+// grant returns a new lease expiring after ttl.
+func (c *EtcdTokenCache) grant(ctx context.Context, ttl time.Duration) (int64, error) {
+	var resp struct {
+		ID int64 `json:"ID,string"`
+	}
+	req := struct {
+		TTL int64 `json:"TTL"`
+	}{int64(math.Ceil(ttl.Seconds()))}
+	if err := c.do(ctx, "/v3/lease/grant", req, &resp); err != nil {
+		return 0, err
+	}
+	return resp.ID, nil
+}
+
+// do sends body as JSON to the JSON gateway's path, decoding the response
+// into v if it's non-nil.
+func (c *EtcdTokenCache) do(ctx context.Context, path string, body, v interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("could not encode etcd request: %s", err)
+	}
+	req, err := http.NewRequest("POST", c.Endpoint+path, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("could not create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(ctx)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send etcd request to %v: %s", path, err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("received non 2xx response status %q from etcd for %v", resp.Status, path)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
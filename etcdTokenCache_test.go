@@ -0,0 +1,165 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v38/github"
+)
+
+// fakeEtcd implements enough of etcd's JSON gateway for EtcdTokenCache.
+type fakeEtcd struct {
+	mu     sync.Mutex
+	kvs    map[string]etcdKeyValue
+	leases int64
+}
+
+func (e *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		e.leases++
+		json.NewEncoder(w).Encode(map[string]string{"ID": fmt.Sprint(e.leases), "TTL": "30"})
+	case "/v3/lease/revoke":
+		var lease struct {
+			ID int64 `json:"ID,string"`
+		}
+		json.NewDecoder(r.Body).Decode(&lease)
+		for k, kv := range e.kvs {
+			if kv.Lease == lease.ID {
+				delete(e.kvs, k)
+			}
+		}
+		w.Write([]byte("{}"))
+	case "/v3/kv/put":
+		var kv etcdKeyValue
+		json.NewDecoder(r.Body).Decode(&kv)
+		e.kvs[string(kv.Key)] = kv
+		w.Write([]byte("{}"))
+	case "/v3/kv/range":
+		var kv etcdKeyValue
+		json.NewDecoder(r.Body).Decode(&kv)
+		resp := struct {
+			KVs []etcdKeyValue `json:"kvs,omitempty"`
+		}{}
+		if kv, ok := e.kvs[string(kv.Key)]; ok {
+			resp.KVs = append(resp.KVs, kv)
+		}
+		json.NewEncoder(w).Encode(resp)
+	case "/v3/kv/txn":
+		var txn struct {
+			Compare []struct {
+				Key []byte `json:"key"`
+			} `json:"compare"`
+			Success []struct {
+				RequestPut etcdKeyValue `json:"request_put"`
+			} `json:"success"`
+		}
+		json.NewDecoder(r.Body).Decode(&txn)
+		_, exists := e.kvs[string(txn.Compare[0].Key)]
+		if !exists {
+			put := txn.Success[0].RequestPut
+			e.kvs[string(put.Key)] = put
+		}
+		json.NewEncoder(w).Encode(map[string]bool{"succeeded": !exists})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestEtcdTokenCache(t *testing.T) {
+	etcd := &fakeEtcd{kvs: make(map[string]etcdKeyValue)}
+	ts := httptest.NewServer(etcd)
+	defer ts.Close()
+
+	cache := NewEtcdTokenCache(http.DefaultClient, ts.URL)
+	ctx := context.Background()
+
+	got, err := cache.Get(ctx, "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got != nil {
+		t.Fatalf("Get() = %v, want nil", got)
+	}
+
+	if err := cache.Set(ctx, "key", &AccessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if etcd.leases != 1 {
+		t.Errorf("granted %d leases, want 1", etcd.leases)
+	}
+	got, err = cache.Get(ctx, "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got == nil || got.Token != token {
+		t.Fatalf("Get() = %v, want token %q", got, token)
+	}
+
+	// Expired tokens aren't stored.
+	if err := cache.Set(ctx, "expired", &AccessToken{Token: token, ExpiresAt: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, ok := etcd.kvs["/ghinstallation/expired"]; ok {
+		t.Error("expired token was stored")
+	}
+}
+
+func TestEtcdTokenCacheWithoutLock(t *testing.T) {
+	var ranges int
+	etcd := &fakeEtcd{kvs: make(map[string]etcdKeyValue)}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v3/kv/range" {
+			ranges++
+		}
+		etcd.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	src := TokenSourceFunc(func(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+		return &AccessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)}, nil
+	})
+	cached := CacheTokenSource(src, NewEtcdTokenCache(http.DefaultClient, ts.URL))
+	if _, err := cached.Token(context.Background(), installationID, nil); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if ranges != 1 {
+		t.Errorf("got %v range requests for a miss, want 1", ranges)
+	}
+}
+
+func TestEtcdTokenCacheLock(t *testing.T) {
+	ts := httptest.NewServer(&fakeEtcd{kvs: make(map[string]etcdKeyValue)})
+	defer ts.Close()
+
+	cache := NewEtcdTokenCache(http.DefaultClient, ts.URL)
+	cache.RefreshLock = true
+
+	unlock, err := cache.Lock(context.Background(), "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// The lock can't be acquired while it's held.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*etcdLockRetry)
+	defer cancel()
+	if _, err := cache.Lock(ctx, "key"); err != context.DeadlineExceeded {
+		t.Fatalf("Lock() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	unlock()
+	unlock, err = cache.Lock(context.Background(), "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	unlock()
+}
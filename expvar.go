@@ -0,0 +1,69 @@
+package ghinstallation
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// Counters published by PublishExpvar. They're always maintained, as that's
+// cheap, but only published when opted in to.
+var (
+	mintsVar        = new(expvar.Int)
+	mintFailuresVar = new(expvar.Int)
+	cacheHitsVar    = new(expvar.Int)
+
+	activeMu sync.Mutex
+	active   = make(map[int64]time.Time) // active is the latest token expiry by installation ID
+
+	publishOnce sync.Once
+)
+
+// PublishExpvar publishes counters under the "ghinstallation" expvar, which is
+// served at /debug/vars by expvar's handler:
+//
+//	token_mints           tokens minted
+//	token_mint_failures   tokens which failed to be minted
+//	token_cache_hits      tokens reused instead of minting a new one
+//	active_installations  installations with a token which hasn't expired
+//
+// Calling PublishExpvar more than once has no effect.
+func PublishExpvar() {
+	publishOnce.Do(func() {
+		m := new(expvar.Map).Init()
+		m.Set("token_mints", mintsVar)
+		m.Set("token_mint_failures", mintFailuresVar)
+		m.Set("token_cache_hits", cacheHitsVar)
+		m.Set("active_installations", expvar.Func(activeInstallations))
+		expvar.Publish("ghinstallation", m)
+	})
+}
+
+// recordMint updates the counters after minting a token for the installation.
+func recordMint(installationID int64, token *AccessToken, err error) {
+	if err != nil {
+		mintFailuresVar.Add(1)
+		return
+	}
+	mintsVar.Add(1)
+
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	if token.ExpiresAt.After(active[installationID]) {
+		active[installationID] = token.ExpiresAt
+	}
+}
+
+// activeInstallations returns the number of installations with a token which
+// hasn't expired, forgetting those which have.
+func activeInstallations() interface{} {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	now := time.Now()
+	for id, expiresAt := range active {
+		if expiresAt.Before(now) {
+			delete(active, id)
+		}
+	}
+	return len(active)
+}
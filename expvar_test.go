@@ -0,0 +1,68 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	PublishExpvar()
+	PublishExpvar()
+
+	get := func() map[string]int64 {
+		var vars map[string]int64
+		if err := json.Unmarshal([]byte(expvar.Get("ghinstallation").String()), &vars); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return vars
+	}
+	before := get()
+
+	fail := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(AccessToken{
+			Token:     token,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+	}))
+	defer ts.Close()
+
+	tr, err := New(&http.Transport{}, appID, 12345, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	tr.BaseURL = ts.URL
+
+	if _, err := tr.Token(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	fail = false
+	for i := 0; i < 2; i++ {
+		if _, err := tr.Token(context.Background()); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	after := get()
+	for name, want := range map[string]int64{
+		"token_mints":         1,
+		"token_mint_failures": 1,
+		"token_cache_hits":    1,
+	} {
+		if got := after[name] - before[name]; got != want {
+			t.Errorf("%s increased by %d, want %d", name, got, want)
+		}
+	}
+	if after["active_installations"] < 1 {
+		t.Errorf("active_installations = %d, want at least 1", after["active_installations"])
+	}
+}
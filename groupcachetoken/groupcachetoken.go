@@ -0,0 +1,125 @@
+// Package groupcachetoken shares installation tokens between a fleet of
+// replicas using a groupcache group, without an external store. It's a
+// separate package so only apps using it depend on groupcache.
+package groupcachetoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/golang/groupcache"
+	"github.com/google/go-github/v38/github"
+)
+
+// window is how long a token obtained through groupcache is used before a
+// new one is obtained. Installation tokens are valid for an hour, so tokens
+// obtained at any time during a window have at least half an hour left when
+// the window ends.
+const window = 30 * time.Minute
+
+// NewTokenSource returns a TokenSource sharing tokens obtained from src
+// between a fleet of replicas using a groupcache group. Each token is
+// obtained from src by the peer owning its key, so only one token is minted
+// for each installation and token options across the fleet, and other peers
+// fetch it from the owner.
+//
+// Every replica must call NewTokenSource with the same name, and register its
+// peers with groupcache, such as using groupcache.NewHTTPPool. The group
+// caches up to cacheBytes of tokens in each replica.
+//
+// Peers request tokens from each other by installation ID and token options,
+// and groupcache doesn't authenticate them, so anyone able to reach the pool
+// could obtain tokens. The pool's handler must only be reachable by the
+// fleet, such as by wrapping it in a handler requiring client certificates
+// or a shared secret, and served over HTTPS as tokens are sent between
+// peers. Additionally, if allow is non-nil, tokens are only obtained from src
+// for the installations and options it returns nil for, limiting what a
+// compromised peer can obtain.
+//
+// As groupcache can't expire or replace values, tokens are shared for 30
+// minute windows, after which a new token is minted. Like groupcache.NewGroup,
+// NewTokenSource panics if a group with the name already exists.
+func NewTokenSource(name string, cacheBytes int64, src ghinstallation.TokenSource, allow func(installationID int64, opts *github.InstallationTokenOptions) error) ghinstallation.TokenSource {
+	return ghinstallation.ReuseTokenSource(newTokenSource(name, cacheBytes, src, allow))
+}
+
+func newTokenSource(name string, cacheBytes int64, src ghinstallation.TokenSource, allow func(installationID int64, opts *github.InstallationTokenOptions) error) *tokenSource {
+	s := &tokenSource{src: src, allow: allow, now: time.Now}
+	s.group = groupcache.NewGroup(name, cacheBytes, groupcache.GetterFunc(s.get))
+	return s
+}
+
+type tokenSource struct {
+	src   ghinstallation.TokenSource
+	allow func(installationID int64, opts *github.InstallationTokenOptions) error
+	now   func() time.Time // now returns the current time, for choosing windows
+	group *groupcache.Group
+}
+
+// Token implements ghinstallation.TokenSource.
+func (s *tokenSource) Token(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*ghinstallation.AccessToken, error) {
+	key := fmt.Sprintf("%d:%d", s.now().Truncate(window).Unix(), installationID)
+	if opts != nil {
+		b, err := json.Marshal(opts)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert installation token parameters into json: %s", err)
+		}
+		key += ":" + string(b)
+	}
+
+	var b []byte
+	if err := s.group.Get(ctx, key, groupcache.AllocatingByteSliceSink(&b)); err != nil {
+		return nil, fmt.Errorf("could not get token from groupcache: %w", err)
+	}
+	token, err := ghinstallation.UnmarshalAccessToken(b)
+	if err != nil {
+		return nil, err
+	}
+	if !token.ExpiresAt.Add(-time.Minute).After(time.Now()) {
+		// The window's token was minted too long ago, such as by a peer
+		// with a skewed clock, so don't share it.
+		return s.src.Token(ctx, installationID, opts)
+	}
+	return token, nil
+}
+
+// get implements groupcache.Getter, obtaining the token for a key created by
+// Token from src.
+func (s *tokenSource) get(ctx context.Context, key string, dest groupcache.Sink) error {
+	// Keys are "window:installationID[:opts]".
+	parts := strings.SplitN(key, ":", 3)
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid groupcache token key %q", key)
+	}
+	installationID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid groupcache token key %q: %s", key, err)
+	}
+	var opts *github.InstallationTokenOptions
+	if len(parts) == 3 {
+		if err := json.Unmarshal([]byte(parts[2]), &opts); err != nil {
+			return fmt.Errorf("invalid groupcache token key %q: %s", key, err)
+		}
+	}
+
+	if s.allow != nil {
+		if err := s.allow(installationID, opts); err != nil {
+			return fmt.Errorf("token for installation id %v not allowed: %w", installationID, err)
+		}
+	}
+
+	token, err := s.src.Token(ctx, installationID, opts)
+	if err != nil {
+		return err
+	}
+	b, err := ghinstallation.MarshalAccessToken(token)
+	if err != nil {
+		return err
+	}
+	return dest.SetBytes(b)
+}
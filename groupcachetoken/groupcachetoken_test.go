@@ -0,0 +1,84 @@
+package groupcachetoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v38/github"
+)
+
+const (
+	installationID = 1
+	token          = "abc123"
+)
+
+type tokenSourceFunc func(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*ghinstallation.AccessToken, error)
+
+func (f tokenSourceFunc) Token(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*ghinstallation.AccessToken, error) {
+	return f(ctx, installationID, opts)
+}
+
+func TestTokenSource(t *testing.T) {
+	var mints []*github.InstallationTokenOptions
+	src := tokenSourceFunc(func(ctx context.Context, id int64, opts *github.InstallationTokenOptions) (*ghinstallation.AccessToken, error) {
+		if id != installationID {
+			return nil, errors.New("unknown installation")
+		}
+		mints = append(mints, opts)
+		return &ghinstallation.AccessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)}, nil
+	})
+
+	allow := func(id int64, opts *github.InstallationTokenOptions) error {
+		if id == installationID+2 {
+			return errors.New("not allowed")
+		}
+		return nil
+	}
+	// Groups can't be unregistered, so use a new name for each run. Use the
+	// unwrapped TokenSource, so tokens aren't reused by ReuseTokenSource
+	// before reaching groupcache.
+	ts := newTokenSource(fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano()), 1<<20, src, allow)
+	// Fix the clock, so the test doesn't cross into another window.
+	now := time.Now()
+	ts.now = func() time.Time { return now }
+	opts := &github.InstallationTokenOptions{
+		RepositoryIDs: []int64{1234},
+		Permissions:   &github.InstallationPermissions{Contents: github.String("read")},
+	}
+	for _, opts := range []*github.InstallationTokenOptions{nil, nil, opts, opts} {
+		got, err := ts.Token(context.Background(), installationID, opts)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if got.Token != token {
+			t.Errorf("got token %q want %q", got.Token, token)
+		}
+	}
+	if diff := cmp.Diff([]*github.InstallationTokenOptions{nil, opts}, mints); diff != "" {
+		t.Errorf("minted tokens with options want->got: %s", diff)
+	}
+
+	if _, err := ts.Token(context.Background(), installationID+1, nil); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := ts.Token(context.Background(), installationID+2, nil); err == nil {
+		t.Error("expected error for disallowed installation")
+	}
+	if len(mints) != 2 {
+		t.Errorf("got %v mints, want disallowed installation not minted", len(mints))
+	}
+
+	// A new window mints a new token.
+	now = now.Add(window)
+	if _, err := ts.Token(context.Background(), installationID, nil); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(mints) != 3 {
+		t.Errorf("got %v mints, want 3 after the window changed", len(mints))
+	}
+}
@@ -0,0 +1,75 @@
+package ghinstallation
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Health describes the state of a Transport's token, such as for reporting
+// from health checks or readiness probes:
+//
+//	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+//		health := itr.Health()
+//		if !health.OK() {
+//			w.WriteHeader(http.StatusServiceUnavailable)
+//		}
+//		json.NewEncoder(w).Encode(health)
+//	})
+type Health struct {
+	LastRefresh time.Time // LastRefresh is when the token was last refreshed, zero if it hasn't been
+	LastError   error     // LastError is why the token couldn't be refreshed since LastRefresh, nil if it hasn't failed
+	LastErrorAt time.Time // LastErrorAt is when LastError occurred
+	ExpiresAt   time.Time // ExpiresAt is when the current token expires, zero if there's none
+}
+
+// OK returns whether the Transport can authenticate requests, which is the
+// case until refreshing the token fails after the current token, if any, has
+// expired. A Transport which hasn't needed a token yet is OK.
+func (h Health) OK() bool {
+	return h.LastError == nil || time.Now().Before(h.ExpiresAt)
+}
+
+// MarshalJSON implements json.Marshaler, encoding LastError as its message
+// and omitting unset times.
+func (h Health) MarshalJSON() ([]byte, error) {
+	v := struct {
+		OK          bool       `json:"ok"`
+		LastRefresh *time.Time `json:"last_refresh,omitempty"`
+		LastError   string     `json:"last_error,omitempty"`
+		LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+		ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	}{
+		OK:          h.OK(),
+		LastRefresh: nonZeroTime(h.LastRefresh),
+		LastErrorAt: nonZeroTime(h.LastErrorAt),
+		ExpiresAt:   nonZeroTime(h.ExpiresAt),
+	}
+	if h.LastError != nil {
+		v.LastError = h.LastError.Error()
+	}
+	return json.Marshal(v)
+}
+
+func nonZeroTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Health returns the state of the token for the Transport's installation.
+// Tokens for other installations, requested using WithInstallationID, aren't
+// included.
+func (t *Transport) Health() Health {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := Health{
+		LastRefresh: t.lastRefresh,
+		LastError:   t.lastError,
+		LastErrorAt: t.lastErrorAt,
+	}
+	if t.token != nil {
+		h.ExpiresAt = t.token.ExpiresAt
+	}
+	return h
+}
@@ -0,0 +1,65 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransportHealth(t *testing.T) {
+	expiresAt := time.Now().Add(-time.Second).Truncate(time.Second)
+	status := http.StatusCreated
+	roundTripper := RoundTrip{
+		rt: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: status,
+				Body:       ioutil.NopCloser(strings.NewReader(fmt.Sprintf(`{"token":%q,"expires_at":%q}`, token, expiresAt.Format(time.RFC3339)))),
+				Request:    req,
+			}, nil
+		},
+	}
+	tr, err := New(roundTripper, appID, installationID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if h := tr.Health(); !h.OK() || !h.LastRefresh.IsZero() {
+		t.Errorf("unused Transport's Health() = %+v, want OK without refresh", h)
+	}
+
+	// The minted token has already expired, so the next refresh is attempted
+	// on the following call.
+	if _, err := tr.Token(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	h := tr.Health()
+	if !h.OK() || h.LastRefresh.IsZero() || !h.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Health() = %+v, want OK refreshed token expiring at %v", h, expiresAt)
+	}
+
+	status = http.StatusUnauthorized
+	if _, err := tr.Token(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	h = tr.Health()
+	var herr *HTTPError
+	if h.OK() || !errors.As(h.LastError, &herr) || h.LastErrorAt.IsZero() {
+		t.Errorf("Health() = %+v, want failed refresh", h)
+	}
+
+	b, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(b, &got)
+	if got["ok"] != false || got["last_error"] == "" || got["expires_at"] != expiresAt.Format(time.RFC3339) {
+		t.Errorf("unexpected JSON: %s", b)
+	}
+}
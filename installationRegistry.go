@@ -0,0 +1,190 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v38/github"
+)
+
+// InstallationRegistry tracks which installation of a GitHub App can access
+// each account and repository, so the installation to act as can be looked
+// up without querying GitHub. It's seeded from the app's installations, and
+// kept up to date by passing it the app's installation and
+// installation_repositories webhook events using HandleEvent.
+//
+// InstallationRegistry is safe for concurrent use.
+type InstallationRegistry struct {
+	mu            sync.RWMutex                   // mu protects the fields below
+	installations map[int64]*github.Installation // installations by ID
+	accounts      map[string]int64               // accounts are installation IDs by lowercase account login
+	repos         map[string]int64               // repos are installation IDs by lowercase full name, for installations with selected repositories
+}
+
+// NewInstallationRegistry returns an InstallationRegistry seeded with the
+// app's installations using atr. The repositories of installations which
+// were granted access to selected repositories, rather than all of the
+// account's, are listed using a token for each such installation.
+func NewInstallationRegistry(ctx context.Context, atr *AppsTransport) (*InstallationRegistry, error) {
+	r := &InstallationRegistry{
+		installations: make(map[int64]*github.Installation),
+		accounts:      make(map[string]int64),
+		repos:         make(map[string]int64),
+	}
+
+	var err error
+	atr.Installations(ctx)(func(installation *github.Installation, ierr error) bool {
+		if ierr != nil {
+			err = ierr
+			return false
+		}
+		var names []string
+		if installation.GetRepositorySelection() == "selected" {
+			t := NewFromAppsTransport(atr, installation.GetID())
+			repos, lerr := t.ListRepositories(ctx)
+			if lerr != nil {
+				err = lerr
+				return false
+			}
+			for _, repo := range repos {
+				names = append(names, repo.GetFullName())
+			}
+		}
+		r.add(installation, names)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not seed installation registry: %w", err)
+	}
+	return r, nil
+}
+
+// add registers installation, with access to the named repositories.
+func (r *InstallationRegistry) add(installation *github.Installation, repos []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := installation.GetID()
+	r.installations[id] = installation
+	r.accounts[strings.ToLower(installation.GetAccount().GetLogin())] = id
+	for _, name := range repos {
+		r.repos[strings.ToLower(name)] = id
+	}
+}
+
+// remove unregisters the installation and its repositories.
+func (r *InstallationRegistry) remove(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if installation, ok := r.installations[id]; ok {
+		delete(r.accounts, strings.ToLower(installation.GetAccount().GetLogin()))
+		delete(r.installations, id)
+	}
+	for name, repoID := range r.repos {
+		if repoID == id {
+			delete(r.repos, name)
+		}
+	}
+}
+
+// Installation returns the installation with the ID, or false if there's
+// none.
+func (r *InstallationRegistry) Installation(id int64) (*github.Installation, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	installation, ok := r.installations[id]
+	return installation, ok
+}
+
+// AccountInstallation returns the installation on the user or organization
+// account, or false if the app isn't installed on it.
+func (r *InstallationRegistry) AccountInstallation(account string) (*github.Installation, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.accounts[strings.ToLower(account)]
+	if !ok {
+		return nil, false
+	}
+	return r.installations[id], true
+}
+
+// RepositoryInstallation returns the installation which can access the
+// repository, or false if there's none.
+func (r *InstallationRegistry) RepositoryInstallation(owner, repo string) (*github.Installation, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if id, ok := r.repos[strings.ToLower(owner+"/"+repo)]; ok {
+		return r.installations[id], true
+	}
+	id, ok := r.accounts[strings.ToLower(owner)]
+	if !ok || r.installations[id].GetRepositorySelection() == "selected" {
+		return nil, false
+	}
+	return r.installations[id], true
+}
+
+// Installations returns the registered installations, ordered by ID.
+func (r *InstallationRegistry) Installations() []*github.Installation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	installations := make([]*github.Installation, 0, len(r.installations))
+	for _, installation := range r.installations {
+		installations = append(installations, installation)
+	}
+	sort.Slice(installations, func(i, j int) bool {
+		return installations[i].GetID() < installations[j].GetID()
+	})
+	return installations
+}
+
+// HandleEvent updates the registry from a webhook event, given its type from
+// the X-GitHub-Event header and its JSON payload. Events other than
+// installation and installation_repositories are ignored.
+//
+// The webhook's signature must be verified before calling HandleEvent, such
+// as by using the webhooks package.
+func (r *InstallationRegistry) HandleEvent(eventType string, payload []byte) error {
+	switch eventType {
+	case "installation":
+		var event github.InstallationEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return fmt.Errorf("could not decode installation event: %s", err)
+		}
+		if event.GetAction() == "deleted" {
+			r.remove(event.GetInstallation().GetID())
+			return nil
+		}
+		if event.GetAction() == "created" {
+			r.remove(event.GetInstallation().GetID())
+		}
+		var names []string
+		for _, repo := range event.Repositories {
+			names = append(names, repo.GetFullName())
+		}
+		r.add(event.GetInstallation(), names)
+	case "installation_repositories":
+		var event github.InstallationRepositoriesEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return fmt.Errorf("could not decode installation_repositories event: %s", err)
+		}
+		installation := event.GetInstallation()
+		if selection := event.GetRepositorySelection(); selection != "" {
+			installation.RepositorySelection = &selection
+		}
+		var added []string
+		for _, repo := range event.RepositoriesAdded {
+			added = append(added, repo.GetFullName())
+		}
+		r.add(installation, added)
+
+		r.mu.Lock()
+		for _, repo := range event.RepositoriesRemoved {
+			delete(r.repos, strings.ToLower(repo.GetFullName()))
+		}
+		r.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInstallationRegistry(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app/installations":
+			fmt.Fprint(w, `[
+				{"id": 1, "account": {"login": "octocat"}, "repository_selection": "all"},
+				{"id": 2, "account": {"login": "Octo-Org"}, "repository_selection": "selected"}
+			]`)
+		case "/app/installations/2/access_tokens":
+			json.NewEncoder(w).Encode(AccessToken{Token: "token-2", ExpiresAt: time.Now().Add(time.Hour)})
+		case "/installation/repositories":
+			if got := r.Header.Get("Authorization"); got != "token token-2" {
+				t.Errorf("Authorization got %q", got)
+			}
+			fmt.Fprint(w, `{"total_count": 1, "repositories": [{"full_name": "octo-org/hello-world"}]}`)
+		default:
+			t.Errorf("unexpected URI: %q", r.RequestURI)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	atr, err := NewAppsTransport(&http.Transport{}, appID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	atr.BaseURL = ts.URL
+
+	r, err := NewInstallationRegistry(context.Background(), atr)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	lookup := func(owner, repo string) int64 {
+		installation, ok := r.RepositoryInstallation(owner, repo)
+		if !ok {
+			return 0
+		}
+		return installation.GetID()
+	}
+	tests := []struct {
+		owner, repo string
+		want        int64
+	}{
+		{"octocat", "anything", 1},
+		{"octo-org", "Hello-World", 2},
+		{"octo-org", "private", 0},
+		{"hubot", "anything", 0},
+	}
+	for _, test := range tests {
+		if got := lookup(test.owner, test.repo); got != test.want {
+			t.Errorf("RepositoryInstallation(%q, %q) = %v, want %v", test.owner, test.repo, got, test.want)
+		}
+	}
+	if installation, ok := r.AccountInstallation("OCTO-ORG"); !ok || installation.GetID() != 2 {
+		t.Errorf("AccountInstallation() = %v, %v, want installation 2", installation, ok)
+	}
+
+	events := []struct{ eventType, payload string }{
+		{"installation", `{"action": "created", "installation": {"id": 3, "account": {"login": "hubot"}, "repository_selection": "selected"}, "repositories": [{"full_name": "hubot/scripts"}]}`},
+		{"installation_repositories", `{"action": "added", "installation": {"id": 2, "account": {"login": "Octo-Org"}}, "repository_selection": "selected", "repositories_added": [{"full_name": "octo-org/private"}], "repositories_removed": [{"full_name": "octo-org/hello-world"}]}`},
+		{"installation", `{"action": "deleted", "installation": {"id": 1, "account": {"login": "octocat"}}}`},
+		{"push", `{}`},
+	}
+	for _, event := range events {
+		if err := r.HandleEvent(event.eventType, []byte(event.payload)); err != nil {
+			t.Fatalf("HandleEvent(%q) unexpected error: %v", event.eventType, err)
+		}
+	}
+
+	tests = []struct {
+		owner, repo string
+		want        int64
+	}{
+		{"octocat", "anything", 0},
+		{"octo-org", "hello-world", 0},
+		{"octo-org", "private", 2},
+		{"hubot", "scripts", 3},
+		{"hubot", "other", 0},
+	}
+	for _, test := range tests {
+		if got := lookup(test.owner, test.repo); got != test.want {
+			t.Errorf("after events, RepositoryInstallation(%q, %q) = %v, want %v", test.owner, test.repo, got, test.want)
+		}
+	}
+
+	var ids []int64
+	for _, installation := range r.Installations() {
+		ids = append(ids, installation.GetID())
+	}
+	if fmt.Sprint(ids) != "[2 3]" {
+		t.Errorf("Installations() = %v, want [2 3]", ids)
+	}
+	if _, ok := r.Installation(1); ok {
+		t.Error("deleted installation still registered")
+	}
+
+	if err := r.HandleEvent("installation", []byte("not json")); err == nil {
+		t.Error("expected error for invalid payload")
+	}
+}
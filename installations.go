@@ -0,0 +1,152 @@
+package ghinstallation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v38/github"
+)
+
+// NewTransportsForAllInstallations returns a Transport for each of the GitHub
+// App's installations, keyed by installation ID. The installations are
+// discovered using atr, and the returned Transports share atr's underlying
+// http.RoundTripper and a single ReuseTokenSource.
+//
+// With WithEagerToken, a token is minted for each installation as it's
+// discovered, and the first failure is returned.
+func NewTransportsForAllInstallations(ctx context.Context, atr *AppsTransport, opts ...Option) (map[int64]*Transport, error) {
+	ts := ReuseTokenSource(atr)
+	transports := make(map[int64]*Transport)
+	var err error
+	atr.Installations(ctx)(func(installation *github.Installation, ierr error) bool {
+		if ierr != nil {
+			err = ierr
+			return false
+		}
+		t := NewFromTokenSource(atr.tr, installation.GetID(), ts)
+		t.BaseURL = atr.BaseURL
+		if err = t.apply(opts); err != nil {
+			return false
+		}
+		transports[installation.GetID()] = t
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transports, nil
+}
+
+// Installations returns an iterator over the GitHub App's installations,
+// fetching each page of installations as it's reached, so they're never all
+// held in memory. If listing installations fails, or ctx is done, the error is
+// yielded and iteration stops.
+//
+// The iterator is an iter.Seq2[*github.Installation, error], so with Go 1.23
+// or later it can be ranged over:
+//
+//	for installation, err := range atr.Installations(ctx) {
+//		if err != nil {
+//			return err
+//		}
+//		// ...
+//	}
+func (t *AppsTransport) Installations(ctx context.Context) func(yield func(*github.Installation, error) bool) {
+	return func(yield func(*github.Installation, error) bool) {
+		client, err := NewAppsClient(t)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		opts := &github.ListOptions{PerPage: 100}
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			installations, resp, err := client.Apps.ListInstallations(ctx, opts)
+			if err != nil {
+				yield(nil, fmt.Errorf("could not list installations: %w", err))
+				return
+			}
+			for _, installation := range installations {
+				if !yield(installation, nil) {
+					return
+				}
+			}
+			if resp.NextPage == 0 {
+				return
+			}
+			opts.Page = resp.NextPage
+		}
+	}
+}
+
+// NotInstalledError is returned when the GitHub App is not installed on an
+// organization, user or repository. InstallURL is where users can install the
+// app, so it can be included in messages shown to them.
+type NotInstalledError struct {
+	Owner      string // Owner is the organization or user
+	Repo       string // Repo is the repository's name, if a repository was looked up
+	AppSlug    string // AppSlug is the app's slug, if it could be determined
+	InstallURL string // InstallURL is the URL to install the app, if it could be determined
+}
+
+func (e *NotInstalledError) Error() string {
+	target := e.Owner
+	if e.Repo != "" {
+		target += "/" + e.Repo
+	}
+	msg := fmt.Sprintf("app is not installed on %v", target)
+	if e.AppSlug != "" {
+		msg = fmt.Sprintf("app %v is not installed on %v", e.AppSlug, target)
+	}
+	if e.InstallURL != "" {
+		msg += ", install it at " + e.InstallURL
+	}
+	return msg
+}
+
+// FindRepositoryInstallation returns the GitHub App's installation which can
+// access the repository. A *NotInstalledError is returned if there's none.
+func (t *AppsTransport) FindRepositoryInstallation(ctx context.Context, owner, repo string) (*github.Installation, error) {
+	client, err := NewAppsClient(t)
+	if err != nil {
+		return nil, err
+	}
+	installation, resp, err := client.Apps.FindRepositoryInstallation(ctx, owner, repo)
+	return t.foundInstallation(ctx, client, installation, resp, err, owner, repo)
+}
+
+// FindOrganizationInstallation returns the GitHub App's installation on the
+// organization. A *NotInstalledError is returned if there's none.
+func (t *AppsTransport) FindOrganizationInstallation(ctx context.Context, org string) (*github.Installation, error) {
+	client, err := NewAppsClient(t)
+	if err != nil {
+		return nil, err
+	}
+	installation, resp, err := client.Apps.FindOrganizationInstallation(ctx, org)
+	return t.foundInstallation(ctx, client, installation, resp, err, org, "")
+}
+
+// foundInstallation returns the result of finding an installation, converting
+// not found errors to a *NotInstalledError.
+func (t *AppsTransport) foundInstallation(ctx context.Context, client *github.Client, installation *github.Installation, resp *github.Response, err error, owner, repo string) (*github.Installation, error) {
+	if err == nil {
+		return installation, nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return nil, fmt.Errorf("could not find installation: %w", err)
+	}
+
+	e := &NotInstalledError{Owner: owner, Repo: repo}
+	if app, _, err := client.Apps.Get(ctx, ""); err == nil {
+		e.AppSlug = app.GetSlug()
+		if app.GetHTMLURL() != "" {
+			e.InstallURL = app.GetHTMLURL() + "/installations/new"
+		}
+	}
+	return nil, e
+}
@@ -0,0 +1,174 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v38/github"
+)
+
+// newInstallationsServer returns a server listing installations 1 to 3 over
+// two pages, and minting tokens for them.
+func newInstallationsServer(t *testing.T) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/app/installations":
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				t.Errorf("Authorization got: %q want bearer token", r.Header.Get("Authorization"))
+			}
+			switch r.URL.Query().Get("page") {
+			case "":
+				w.Header().Set("Link", fmt.Sprintf(`<%s/app/installations?page=2>; rel="next"`, ts.URL))
+				fmt.Fprintln(w, `[{"id": 1, "account": {"login": "octocat"}}, {"id": 2, "account": {"login": "octo-org"}}]`)
+			case "2":
+				fmt.Fprintln(w, `[{"id": 3, "account": {"login": "hubot"}, "suspended_at": "2016-07-11T22:14:10Z"}]`)
+			}
+		case strings.HasSuffix(r.URL.Path, "/access_tokens"):
+			var id int64
+			fmt.Sscanf(r.URL.Path, "/app/installations/%d/access_tokens", &id)
+			json.NewEncoder(w).Encode(AccessToken{
+				Token:     fmt.Sprintf("token-%d", id),
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+		default:
+			t.Errorf("unexpected URI: %q", r.RequestURI)
+			http.NotFound(w, r)
+		}
+	}))
+	return ts
+}
+
+func TestNewTransportsForAllInstallations(t *testing.T) {
+	ts := newInstallationsServer(t)
+	defer ts.Close()
+
+	atr, err := NewAppsTransport(&http.Transport{}, appID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	atr.BaseURL = ts.URL
+
+	opts := &github.InstallationTokenOptions{RepositoryIDs: []int64{1234}}
+	transports, err := NewTransportsForAllInstallations(context.Background(), atr, WithInstallationTokenOptions(opts))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(transports) != 3 {
+		t.Fatalf("got %d transports, want 3", len(transports))
+	}
+
+	for id, tr := range transports {
+		if tr.InstallationTokenOptions != opts {
+			t.Errorf("installation %d's transport has token options %v, want %v", id, tr.InstallationTokenOptions, opts)
+		}
+		got, err := tr.Token(context.Background())
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if want := fmt.Sprintf("token-%d", id); got != want {
+			t.Errorf("installation %d's token = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestInstallations(t *testing.T) {
+	ts := newInstallationsServer(t)
+	defer ts.Close()
+
+	atr, err := NewAppsTransport(&http.Transport{}, appID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	atr.BaseURL = ts.URL
+
+	var ids []int64
+	atr.Installations(context.Background())(func(installation *github.Installation, err error) bool {
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		ids = append(ids, installation.GetID())
+		return true
+	})
+	if diff := cmp.Diff([]int64{1, 2, 3}, ids); diff != "" {
+		t.Errorf("installation IDs want->got: %s", diff)
+	}
+
+	// Stopping early doesn't fetch the next page.
+	ids = nil
+	atr.Installations(context.Background())(func(installation *github.Installation, err error) bool {
+		ids = append(ids, installation.GetID())
+		return false
+	})
+	if diff := cmp.Diff([]int64{1}, ids); diff != "" {
+		t.Errorf("installation IDs want->got: %s", diff)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var gotErr error
+	atr.Installations(ctx)(func(installation *github.Installation, err error) bool {
+		gotErr = err
+		return true
+	})
+	if gotErr != context.Canceled {
+		t.Errorf("Installations() err = %v, want %v", gotErr, context.Canceled)
+	}
+}
+
+func TestFindRepositoryInstallation(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/octocat/hello-world/installation":
+			fmt.Fprintln(w, `{"id": 1}`)
+		case "/repos/octocat/private/installation", "/orgs/octo-org/installation":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, `{"message": "Not Found"}`)
+		case "/app":
+			fmt.Fprintln(w, `{"slug": "my-app", "html_url": "https://github.com/apps/my-app"}`)
+		default:
+			t.Errorf("unexpected URI: %q", r.RequestURI)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	atr, err := NewAppsTransport(&http.Transport{}, appID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	atr.BaseURL = ts.URL
+
+	installation, err := atr.FindRepositoryInstallation(context.Background(), "octocat", "hello-world")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if installation.GetID() != 1 {
+		t.Errorf("installation ID = %v, want 1", installation.GetID())
+	}
+
+	_, err = atr.FindRepositoryInstallation(context.Background(), "octocat", "private")
+	want := &NotInstalledError{
+		Owner:      "octocat",
+		Repo:       "private",
+		AppSlug:    "my-app",
+		InstallURL: "https://github.com/apps/my-app/installations/new",
+	}
+	if diff := cmp.Diff(want, err); diff != "" {
+		t.Errorf("FindRepositoryInstallation() err want->got: %s", diff)
+	}
+
+	_, err = atr.FindOrganizationInstallation(context.Background(), "octo-org")
+	var nerr *NotInstalledError
+	if !errors.As(err, &nerr) || nerr.Owner != "octo-org" {
+		t.Errorf("FindOrganizationInstallation() err = %v, want NotInstalledError", err)
+	}
+}
@@ -0,0 +1,46 @@
+// Package signature validates the X-Hub-Signature-256 header of webhooks
+// delivered by GitHub.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrMissing is returned when a webhook has no signature.
+	ErrMissing = errors.New("missing X-Hub-Signature-256 header")
+	// ErrInvalid is returned when a webhook's signature doesn't match its
+	// payload.
+	ErrInvalid = errors.New("invalid X-Hub-Signature-256 header")
+	// ErrEmptySecret is returned when validating a signature using an empty
+	// secret, which anyone could forge signatures with.
+	ErrEmptySecret = errors.New("empty webhook secret")
+)
+
+// Validate returns nil if signature, the value of a webhook's
+// X-Hub-Signature-256 header, is the HMAC-SHA256 of payload using secret.
+func Validate(signature string, payload, secret []byte) error {
+	if len(secret) == 0 {
+		return ErrEmptySecret
+	}
+	if signature == "" {
+		return ErrMissing
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		return ErrInvalid
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return ErrInvalid
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalid
+	}
+	return nil
+}
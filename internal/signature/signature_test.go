@@ -0,0 +1,27 @@
+package signature
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	// GitHub's documented example.
+	secret := []byte("It's a Secret to Everybody")
+	signature := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+
+	tests := []struct {
+		signature string
+		payload   string
+		secret    []byte
+		want      error
+	}{
+		{signature, "Hello, World!", secret, nil},
+		{signature, "Hello, World?", secret, ErrInvalid},
+		{"", "Hello, World!", secret, ErrMissing},
+		{"sha256=not hex", "Hello, World!", secret, ErrInvalid},
+		{signature, "Hello, World!", nil, ErrEmptySecret},
+	}
+	for _, test := range tests {
+		if got := Validate(test.signature, []byte(test.payload), test.secret); got != test.want {
+			t.Errorf("Validate(%q, %q, %q) = %v, want %v", test.signature, test.payload, test.secret, got, test.want)
+		}
+	}
+}
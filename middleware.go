@@ -0,0 +1,89 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/bradleyfalzon/ghinstallation/v2/internal/signature"
+	"github.com/google/go-github/v38/github"
+)
+
+// maxWebhookBody is the most of a request's body read by NewClientMiddleware,
+// GitHub caps webhook payloads at 25MB.
+const maxWebhookBody = 25 << 20
+
+// clientKey is the context key for the client set by NewClientMiddleware.
+type clientKey struct{}
+
+// NewClientMiddleware returns middleware which authenticates a *github.Client
+// as the installation a webhook was delivered for, identified by the
+// installation.id field of the request's JSON body, and adds it to the
+// request's context for the wrapped handler to retrieve using
+// ClientFromContext. The request's body remains readable by the handler.
+//
+// The webhook's X-Hub-Signature-256 header is validated using the app's
+// webhook secret before the body is parsed, and requests without a valid
+// signature are rejected with 401 Unauthorized, so clients are only created
+// for webhooks sent by GitHub. If secret is empty, which anyone could sign
+// webhooks with, every request is answered with 500 Internal Server Error.
+//
+// Requests without an installation, such as the ping event of an app's
+// webhook, are passed to the handler without a client.
+//
+// Clients share atr's underlying http.RoundTripper and a ReuseTokenSource, so
+// each installation's token is only minted when it's about to expire.
+func NewClientMiddleware(atr *AppsTransport, secret []byte, opts ...Option) func(http.Handler) http.Handler {
+	ts := ReuseTokenSource(atr)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+			r.Body.Close()
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			if err != nil {
+				http.Error(w, "could not read request body", http.StatusBadRequest)
+				return
+			}
+			if err := signature.Validate(r.Header.Get("X-Hub-Signature-256"), body, secret); err == signature.ErrEmptySecret {
+				http.Error(w, "webhook secret is not configured", http.StatusInternalServerError)
+				return
+			} else if err != nil {
+				http.Error(w, "invalid webhook signature", http.StatusUnauthorized)
+				return
+			}
+
+			var event struct {
+				Installation struct {
+					ID int64 `json:"id"`
+				} `json:"installation"`
+			}
+			if json.Unmarshal(body, &event) != nil || event.Installation.ID == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			t := NewFromTokenSource(atr.tr, event.Installation.ID, ts)
+			t.BaseURL = atr.BaseURL
+			if err := t.apply(opts); err != nil {
+				http.Error(w, "could not authenticate installation", http.StatusBadGateway)
+				return
+			}
+			client, err := newGitHubClient(t.BaseURL, t)
+			if err != nil {
+				http.Error(w, "could not create client", http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, client)))
+		})
+	}
+}
+
+// ClientFromContext returns the client added to a request's context by
+// NewClientMiddleware, or false if there's none.
+func ClientFromContext(ctx context.Context) (*github.Client, bool) {
+	client, ok := ctx.Value(clientKey{}).(*github.Client)
+	return client, ok
+}
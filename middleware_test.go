@@ -0,0 +1,112 @@
+package ghinstallation
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientMiddleware(t *testing.T) {
+	var mints int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app/installations/99/access_tokens":
+			mints++
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token":"abc123","expires_at":%q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+		case "/repos/o/r":
+			if got := r.Header.Get("Authorization"); got != "token abc123" {
+				t.Errorf("Authorization got %q", got)
+			}
+			fmt.Fprint(w, `{"id":1}`)
+		default:
+			t.Errorf("unexpected request to %v", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	atr, err := NewAppsTransport(http.DefaultTransport, appID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	atr.BaseURL = ts.URL
+
+	handler := NewClientMiddleware(atr, []byte("secret"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		client, ok := ClientFromContext(r.Context())
+		if !strings.Contains(string(body), "installation") {
+			if ok {
+				t.Error("client set for request without installation")
+			}
+			return
+		}
+		if !ok {
+			t.Fatal("no client in context")
+		}
+		repo, _, err := client.Repositories.Get(r.Context(), "o", "r")
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if repo.GetID() != 1 {
+			t.Errorf("got repository %v", repo.GetID())
+		}
+	}))
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	opened := `{"action":"opened","installation":{"id":99}}`
+	ping := `{"zen":"Keep it logically awesome.","hook_id":1}`
+	forged := `{"action":"opened","installation":{"id":98}}`
+	for _, test := range []struct {
+		body      string
+		signature string
+		want      int
+	}{
+		{opened, sign(opened), http.StatusOK},
+		{opened, sign(opened), http.StatusOK},
+		{ping, sign(ping), http.StatusOK},
+		{forged, "", http.StatusUnauthorized},
+		{forged, sign(opened), http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("POST", "/webhook", strings.NewReader(test.body))
+		req.Header.Set("X-Hub-Signature-256", test.signature)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.want {
+			t.Errorf("got status %v, want %v", rec.Code, test.want)
+		}
+	}
+
+	// Anyone can sign webhooks with an empty secret.
+	unsigned := NewClientMiddleware(atr, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called with an empty secret")
+	}))
+	mac := hmac.New(sha256.New, nil)
+	mac.Write([]byte(forged))
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(forged))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	rec := httptest.NewRecorder()
+	unsigned.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got status %v with an empty secret, want %v", rec.Code, http.StatusInternalServerError)
+	}
+
+	if mints != 1 {
+		t.Errorf("got %v mints, want 1", mints)
+	}
+
+	if _, ok := ClientFromContext(context.Background()); ok {
+		t.Error("ClientFromContext ok for empty context")
+	}
+}
@@ -0,0 +1,58 @@
+package ghinstallation
+
+import "github.com/google/go-github/v38/github"
+
+// The following presets restrict installation tokens to the permissions
+// commonly needed for a task, for use as a Transport's
+// InstallationTokenOptions or with WithInstallationTokenOptions. Tokens are
+// restricted to repositoryIDs if any are given, otherwise they can access all
+// of the installation's repositories.
+//
+// The installation must have been granted at least the preset's permissions,
+// or minting tokens fails.
+
+// ReadOnlyContents returns options restricting tokens to reading repository
+// contents, such as for cloning or fetching files.
+func ReadOnlyContents(repositoryIDs ...int64) *github.InstallationTokenOptions {
+	return preset(repositoryIDs, &github.InstallationPermissions{
+		Contents: github.String("read"),
+		Metadata: github.String("read"),
+	})
+}
+
+// CIRunner returns options restricting tokens to cloning repositories and
+// reporting check runs and commit statuses.
+func CIRunner(repositoryIDs ...int64) *github.InstallationTokenOptions {
+	return preset(repositoryIDs, &github.InstallationPermissions{
+		Checks:   github.String("write"),
+		Contents: github.String("read"),
+		Metadata: github.String("read"),
+		Statuses: github.String("write"),
+	})
+}
+
+// ReleasePublisher returns options restricting tokens to creating releases
+// and uploading their assets, which requires write access to contents.
+func ReleasePublisher(repositoryIDs ...int64) *github.InstallationTokenOptions {
+	return preset(repositoryIDs, &github.InstallationPermissions{
+		Contents: github.String("write"),
+		Metadata: github.String("read"),
+	})
+}
+
+// IssueTriage returns options restricting tokens to commenting on, labelling,
+// assigning and closing issues and pull requests, without access to contents.
+func IssueTriage(repositoryIDs ...int64) *github.InstallationTokenOptions {
+	return preset(repositoryIDs, &github.InstallationPermissions{
+		Issues:       github.String("write"),
+		Metadata:     github.String("read"),
+		PullRequests: github.String("write"),
+	})
+}
+
+func preset(repositoryIDs []int64, perms *github.InstallationPermissions) *github.InstallationTokenOptions {
+	return &github.InstallationTokenOptions{
+		RepositoryIDs: repositoryIDs,
+		Permissions:   perms,
+	}
+}
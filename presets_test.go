@@ -0,0 +1,38 @@
+package ghinstallation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPresets(t *testing.T) {
+	tests := []struct {
+		name string
+		got  interface{}
+		want string
+	}{
+		{"ReadOnlyContents", ReadOnlyContents(), `{"permissions":{"contents":"read","metadata":"read"}}`},
+		{"CIRunner", CIRunner(1), `{"repository_ids":[1],"permissions":{"checks":"write","contents":"read","metadata":"read","statuses":"write"}}`},
+		{"ReleasePublisher", ReleasePublisher(1, 2), `{"repository_ids":[1,2],"permissions":{"contents":"write","metadata":"read"}}`},
+		{"IssueTriage", IssueTriage(), `{"permissions":{"issues":"write","metadata":"read","pull_requests":"write"}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := json.Marshal(test.got)
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			if string(b) != test.want {
+				t.Errorf("got %s want %s", b, test.want)
+			}
+		})
+	}
+}
+
+func TestPresetsAreIndependent(t *testing.T) {
+	opts := ReadOnlyContents()
+	opts.Permissions.Contents = nil
+	if ReadOnlyContents().Permissions.Contents == nil {
+		t.Error("modifying a preset modified later presets")
+	}
+}
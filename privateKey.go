@@ -0,0 +1,86 @@
+package ghinstallation
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrKeyNotPEM means the private key is not PEM encoded.
+	ErrKeyNotPEM = errors.New("key must be PEM encoded")
+	// ErrKeyWrongBlockType means the PEM block is not a private key, such as
+	// a public key or certificate.
+	ErrKeyWrongBlockType = errors.New("PEM block is not a private key")
+	// ErrKeyEncrypted means the private key is encrypted, GitHub Apps'
+	// private keys must be decrypted before use.
+	ErrKeyEncrypted = errors.New("key is encrypted")
+	// ErrKeyNotRSA means the private key is not an RSA key.
+	ErrKeyNotRSA = errors.New("key is not an RSA private key")
+	// ErrKeyOpenSSH means the private key is in OpenSSH's format, which may
+	// hold an RSA key but must be converted to PKCS1 or PKCS8 PEM first.
+	ErrKeyOpenSSH = errors.New("key is in OpenSSH format, convert it to PEM such as with ssh-keygen -p -m PEM")
+	// ErrKeyInvalid means the private key could not be decoded.
+	ErrKeyInvalid = errors.New("key is invalid")
+)
+
+// KeyError is returned when a GitHub App's private key cannot be parsed.
+// Reason is one of the ErrKey errors, and can be checked using errors.Is.
+type KeyError struct {
+	Reason    error
+	BlockType string // BlockType is the PEM block's type, if the key is PEM encoded
+	Cause     error  // Cause is the underlying error when the key is invalid
+}
+
+func (e *KeyError) Error() string {
+	msg := e.Reason.Error()
+	if e.BlockType != "" {
+		msg += " (PEM block type " + e.BlockType + ")"
+	}
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Unwrap returns Reason.
+func (e *KeyError) Unwrap() error {
+	return e.Reason
+}
+
+// parsePrivateKey parses a PEM encoded PKCS1 or PKCS8 RSA private key.
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, &KeyError{Reason: ErrKeyNotPEM}
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		return nil, &KeyError{Reason: ErrKeyEncrypted, BlockType: block.Type}
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY", "PRIVATE KEY":
+	case "EC PRIVATE KEY", "DSA PRIVATE KEY":
+		return nil, &KeyError{Reason: ErrKeyNotRSA, BlockType: block.Type}
+	case "OPENSSH PRIVATE KEY":
+		return nil, &KeyError{Reason: ErrKeyOpenSSH, BlockType: block.Type}
+	default:
+		return nil, &KeyError{Reason: ErrKeyWrongBlockType, BlockType: block.Type}
+	}
+
+	// Keys are occasionally labelled with the wrong type, so try both formats.
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, &KeyError{Reason: ErrKeyInvalid, BlockType: block.Type, Cause: err}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, &KeyError{Reason: ErrKeyNotRSA, BlockType: block.Type}
+	}
+	return key, nil
+}
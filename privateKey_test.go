@@ -0,0 +1,72 @@
+package ghinstallation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParsePrivateKey(t *testing.T) {
+	rsaKey, err := parsePrivateKey(key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	pkcs8RSA, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1EC, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8EC, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		key  []byte
+		want error
+	}{
+		"pkcs1":       {key: key},
+		"pkcs8":       {key: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8RSA})},
+		"not pem":     {key: []byte("not a key"), want: ErrKeyNotPEM},
+		"public key":  {key: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), want: ErrKeyWrongBlockType},
+		"encrypted":   {key: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Headers: map[string]string{"Proc-Type": "4,ENCRYPTED"}, Bytes: []byte{1}}), want: ErrKeyEncrypted},
+		"pkcs8 enc":   {key: pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte{1}}), want: ErrKeyEncrypted},
+		"ec":          {key: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1EC}), want: ErrKeyNotRSA},
+		"pkcs8 ec":    {key: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8EC}), want: ErrKeyNotRSA},
+		"invalid der": {key: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte{1}}), want: ErrKeyInvalid},
+		"openssh":     {key: pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: []byte("openssh-key-v1\x00")}), want: ErrKeyOpenSSH},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parsePrivateKey(test.key)
+			if !errors.Is(err, test.want) {
+				t.Errorf("parsePrivateKey() err = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestNewAppsTransportKeyError(t *testing.T) {
+	_, err := NewAppsTransport(&http.Transport{}, appID, []byte("not a key"))
+	var kerr *KeyError
+	if !errors.As(err, &kerr) || kerr.Reason != ErrKeyNotPEM {
+		t.Errorf("NewAppsTransport() err = %v, want KeyError with reason %v", err, ErrKeyNotPEM)
+	}
+}
@@ -0,0 +1,87 @@
+package ghinstallation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// sqliteTokenCacheTable is the table tokens are stored in.
+const sqliteTokenCacheTable = "ghinstallation_tokens"
+
+// SQLiteTokenCache is a TokenCache storing tokens in a SQLite database, which
+// allows multiple processes on the same host to share tokens using a single
+// file.
+type SQLiteTokenCache struct {
+	db *sql.DB
+}
+
+var _ TokenCache = &SQLiteTokenCache{}
+
+// NewSQLiteTokenCache returns a SQLiteTokenCache using db, which must have
+// been opened using a SQLite driver such as modernc.org/sqlite or
+// github.com/mattn/go-sqlite3. The database is switched to WAL mode and the
+// table tokens are stored in is created if it doesn't exist.
+//
+// As multiple processes may write to the database at the same time, db should
+// be opened with a busy timeout, such as "_pragma=busy_timeout(5000)" for
+// modernc.org/sqlite or "_busy_timeout=5000" for github.com/mattn/go-sqlite3.
+func NewSQLiteTokenCache(ctx context.Context, db *sql.DB) (*SQLiteTokenCache, error) {
+	// WAL mode is persisted in the database file, so only needs to be set once.
+	if _, err := db.ExecContext(ctx, "PRAGMA journal_mode=WAL"); err != nil {
+		return nil, fmt.Errorf("could not enable WAL mode: %s", err)
+	}
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+sqliteTokenCacheTable+` (
+		key TEXT PRIMARY KEY,
+		token BLOB NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("could not create %s table: %s", sqliteTokenCacheTable, err)
+	}
+	return &SQLiteTokenCache{db: db}, nil
+}
+
+// Get implements TokenCache.
+func (c *SQLiteTokenCache) Get(ctx context.Context, key string) (*AccessToken, error) {
+	var b []byte
+	err := c.db.QueryRowContext(ctx,
+		"SELECT token FROM "+sqliteTokenCacheTable+" WHERE key = ? AND expires_at > ?",
+		key, time.Now().Unix(),
+	).Scan(&b)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get token: %s", err)
+	}
+
+	return UnmarshalAccessToken(b)
+}
+
+// Set implements TokenCache. Expired tokens are removed at the same time.
+func (c *SQLiteTokenCache) Set(ctx context.Context, key string, token *AccessToken) error {
+	b, err := MarshalAccessToken(token)
+	if err != nil {
+		return fmt.Errorf("could not encode token: %s", err)
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM "+sqliteTokenCacheTable+" WHERE expires_at <= ?", time.Now().Unix()); err != nil {
+		return fmt.Errorf("could not remove expired tokens: %s", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT OR REPLACE INTO "+sqliteTokenCacheTable+" (key, token, expires_at) VALUES (?, ?, ?)",
+		key, b, token.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("could not set token: %s", err)
+	}
+	return tx.Commit()
+}
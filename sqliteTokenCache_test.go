@@ -0,0 +1,161 @@
+package ghinstallation
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	sql.Register("fakesqlite", &fakeSQLite{dbs: make(map[string]*fakeSQLiteDB)})
+}
+
+// fakeSQLite is a database/sql driver implementing enough of SQLite for
+// SQLiteTokenCache, with a database for each name opened.
+type fakeSQLite struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeSQLiteDB
+}
+
+type fakeSQLiteDB struct {
+	mu   sync.Mutex
+	rows map[string]fakeSQLiteRow // rows by key
+}
+
+type fakeSQLiteRow struct {
+	token     []byte
+	expiresAt int64
+}
+
+func (d *fakeSQLite) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db, ok := d.dbs[name]
+	if !ok {
+		db = &fakeSQLiteDB{rows: make(map[string]fakeSQLiteRow)}
+		d.dbs[name] = db
+	}
+	return db, nil
+}
+
+func (db *fakeSQLiteDB) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLiteStmt{db: db, query: query}, nil
+}
+
+func (db *fakeSQLiteDB) Close() error              { return nil }
+func (db *fakeSQLiteDB) Begin() (driver.Tx, error) { return db, nil }
+func (db *fakeSQLiteDB) Commit() error             { return nil }
+func (db *fakeSQLiteDB) Rollback() error           { return nil }
+
+type fakeSQLiteStmt struct {
+	db    *fakeSQLiteDB
+	query string
+}
+
+func (s *fakeSQLiteStmt) Close() error  { return nil }
+func (s *fakeSQLiteStmt) NumInput() int { return -1 }
+
+func (s *fakeSQLiteStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "PRAGMA journal_mode=WAL"), strings.HasPrefix(s.query, "CREATE TABLE IF NOT EXISTS"):
+	case strings.HasPrefix(s.query, "DELETE FROM "+sqliteTokenCacheTable+" WHERE expires_at <= ?"):
+		for key, row := range s.db.rows {
+			if row.expiresAt <= args[0].(int64) {
+				delete(s.db.rows, key)
+			}
+		}
+	case strings.HasPrefix(s.query, "INSERT OR REPLACE INTO "+sqliteTokenCacheTable):
+		s.db.rows[args[0].(string)] = fakeSQLiteRow{token: args[1].([]byte), expiresAt: args[2].(int64)}
+	default:
+		return nil, fmt.Errorf("unexpected query %q", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeSQLiteStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if !strings.HasPrefix(s.query, "SELECT token FROM "+sqliteTokenCacheTable+" WHERE key = ? AND expires_at > ?") {
+		return nil, fmt.Errorf("unexpected query %q", s.query)
+	}
+	rows := &fakeSQLiteRows{}
+	if row, ok := s.db.rows[args[0].(string)]; ok && row.expiresAt > args[1].(int64) {
+		rows.tokens = append(rows.tokens, row.token)
+	}
+	return rows, nil
+}
+
+type fakeSQLiteRows struct {
+	tokens [][]byte
+}
+
+func (r *fakeSQLiteRows) Columns() []string { return []string{"token"} }
+func (r *fakeSQLiteRows) Close() error      { return nil }
+
+func (r *fakeSQLiteRows) Next(dest []driver.Value) error {
+	if len(r.tokens) == 0 {
+		return io.EOF
+	}
+	dest[0], r.tokens = r.tokens[0], r.tokens[1:]
+	return nil
+}
+
+func TestSQLiteTokenCache(t *testing.T) {
+	// The driver's databases outlive the test, so use a new one for each run.
+	dsn := fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+	db, err := sql.Open("fakesqlite", dsn)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	cache, err := NewSQLiteTokenCache(ctx, db)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got, err := cache.Get(ctx, "key"); err != nil || got != nil {
+		t.Fatalf("Get() = %v, %v, want nil", got, err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := cache.Set(ctx, "key", &AccessToken{Token: "old", ExpiresAt: expiresAt}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := cache.Set(ctx, "key", &AccessToken{Token: token, ExpiresAt: expiresAt}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	got, err := cache.Get(ctx, "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got == nil || got.Token != token || !got.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("Get() = %v, want token %q expiring at %v", got, token, expiresAt)
+	}
+
+	// Expired tokens aren't returned, and are removed by the next Set.
+	if err := cache.Set(ctx, "expired", &AccessToken{Token: token, ExpiresAt: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got, err := cache.Get(ctx, "expired"); err != nil || got != nil {
+		t.Errorf("Get() of expired token = %v, %v, want nil", got, err)
+	}
+	if err := cache.Set(ctx, "other", &AccessToken{Token: token, ExpiresAt: expiresAt}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	fake := db.Driver().(*fakeSQLite).dbs[dsn]
+	if _, ok := fake.rows["expired"]; ok {
+		t.Error("expired token was not removed")
+	}
+	if len(fake.rows) != 2 {
+		t.Errorf("got %v rows, want 2", len(fake.rows))
+	}
+}
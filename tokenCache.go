@@ -0,0 +1,154 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v38/github"
+)
+
+// TokenCache stores installation access tokens outside of the process, so
+// they can be shared by multiple processes or survive restarts.
+//
+// Implementations storing tokens externally should encode them using
+// MarshalAccessToken.
+//
+// Implementations must be safe for concurrent use.
+type TokenCache interface {
+	// Get returns the token stored under key, or nil if there's no token
+	// stored or it has expired.
+	Get(ctx context.Context, key string) (*AccessToken, error)
+	// Set stores token under key until it expires.
+	Set(ctx context.Context, key string, token *AccessToken) error
+}
+
+// tokenCacheVersion is the version of the format written by
+// MarshalAccessToken.
+//
+// Versions must only add fields, so older versions can still read the format.
+// If that's not possible, minTokenCacheVersion must be raised to the oldest
+// version able to read it.
+const (
+	tokenCacheVersion    = 1
+	minTokenCacheVersion = 1
+)
+
+// cachedToken is the format tokens are stored in by TokenCaches.
+type cachedToken struct {
+	Version    int `json:"version"`               // Version of the format which was written
+	MinVersion int `json:"min_version,omitempty"` // MinVersion is the oldest version able to read the format
+	*AccessToken
+}
+
+// MarshalAccessToken encodes token in a stable, versioned format for storing
+// in a TokenCache shared by processes which may be running different versions
+// of this package, such as during a rolling upgrade.
+func MarshalAccessToken(token *AccessToken) ([]byte, error) {
+	return json.Marshal(cachedToken{
+		Version:     tokenCacheVersion,
+		MinVersion:  minTokenCacheVersion,
+		AccessToken: token,
+	})
+}
+
+// UnmarshalAccessToken decodes a token encoded by MarshalAccessToken. Tokens
+// written by newer versions are decoded as long as they remain readable by
+// this version, ignoring any fields this version doesn't know about. Tokens
+// encoded as plain AccessToken JSON, as written before the format was
+// versioned, are also accepted.
+func UnmarshalAccessToken(b []byte) (*AccessToken, error) {
+	ct := cachedToken{AccessToken: &AccessToken{}}
+	if err := json.Unmarshal(b, &ct); err != nil {
+		return nil, fmt.Errorf("could not decode token: %s", err)
+	}
+	if ct.MinVersion > tokenCacheVersion {
+		return nil, fmt.Errorf("could not decode token: version %v requires version %v, only version %v is supported", ct.Version, ct.MinVersion, tokenCacheVersion)
+	}
+	if ct.Token == "" || ct.ExpiresAt.IsZero() {
+		return nil, fmt.Errorf("could not decode token: missing token or expiry")
+	}
+	return ct.AccessToken, nil
+}
+
+// TokenCacheLocker is optionally implemented by TokenCaches which can ensure
+// only one of the processes sharing the cache refreshes a token at a time.
+type TokenCacheLocker interface {
+	// Lock blocks until the lock for key is acquired or ctx is done. The
+	// returned func releases the lock.
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+// CacheTokenSource returns a TokenSource which returns tokens stored in cache,
+// obtaining them from src and storing them when they're missing or about to
+// expire.
+//
+// If cache implements TokenCacheLocker, the lock for the token is held while
+// obtaining it from src, so processes sharing the cache don't all refresh it
+// at once.
+//
+// Errors reading from or writing to cache are not fatal, the token from src
+// is used instead.
+func CacheTokenSource(src TokenSource, cache TokenCache) TokenSource {
+	return &cacheTokenSource{src: src, cache: cache}
+}
+
+type cacheTokenSource struct {
+	src   TokenSource
+	cache TokenCache
+}
+
+// Token implements TokenSource.
+func (s *cacheTokenSource) Token(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+	key, err := tokenCacheKey(installationID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if token := s.get(ctx, key); token != nil {
+		cacheHitsVar.Add(1)
+		return token, nil
+	}
+
+	if locker, ok := s.cache.(TokenCacheLocker); ok {
+		if unlock, err := locker.Lock(ctx, key); err == nil {
+			defer unlock()
+			// Another process may have refreshed the token while waiting.
+			if token := s.get(ctx, key); token != nil {
+				cacheHitsVar.Add(1)
+				return token, nil
+			}
+		}
+	}
+
+	token, err := s.src.Token(ctx, installationID, opts)
+	if err != nil {
+		return nil, err
+	}
+	_ = s.cache.Set(ctx, key, token)
+	return token, nil
+}
+
+// get returns the cached token, or nil if it's unavailable or about to expire.
+func (s *cacheTokenSource) get(ctx context.Context, key string) *AccessToken {
+	token, err := s.cache.Get(ctx, key)
+	if err != nil || token == nil || token.ExpiresAt.Add(-time.Minute).Before(time.Now()) {
+		return nil
+	}
+	return token
+}
+
+// tokenCacheKey returns the key a token for the installation, restricted by
+// opts, is stored under.
+func tokenCacheKey(installationID int64, opts *github.InstallationTokenOptions) (string, error) {
+	key := fmt.Sprintf("ghinstallation:%d", installationID)
+	if opts != nil {
+		b, err := json.Marshal(opts)
+		if err != nil {
+			return "", fmt.Errorf("could not convert installation token parameters into json: %s", err)
+		}
+		key += ":" + string(b)
+	}
+	return key, nil
+}
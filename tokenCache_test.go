@@ -0,0 +1,135 @@
+package ghinstallation
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v38/github"
+)
+
+type mapTokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]*AccessToken
+}
+
+func (c *mapTokenCache) Get(ctx context.Context, key string) (*AccessToken, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens[key], nil
+}
+
+func (c *mapTokenCache) Set(ctx context.Context, key string, token *AccessToken) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[key] = token
+	return nil
+}
+
+func TestCacheTokenSource(t *testing.T) {
+	var calls int
+	src := TokenSourceFunc(func(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+		calls++
+		return &AccessToken{
+			Token:     token,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}, nil
+	})
+	cache := &mapTokenCache{tokens: make(map[string]*AccessToken)}
+
+	// Sources sharing a cache, such as in separate processes, share tokens.
+	for i := 0; i < 2; i++ {
+		got, err := CacheTokenSource(src, cache).Token(context.Background(), installationID, nil)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if got.Token != token {
+			t.Errorf("Token() = %q, want %q", got.Token, token)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("source called %d times, want 1", calls)
+	}
+
+	// Nearly expired tokens are replaced.
+	key, _ := tokenCacheKey(installationID, nil)
+	cache.tokens[key].ExpiresAt = time.Now()
+	if _, err := CacheTokenSource(src, cache).Token(context.Background(), installationID, nil); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if calls != 2 {
+		t.Errorf("source called %d times, want 2", calls)
+	}
+}
+
+func TestMarshalAccessToken(t *testing.T) {
+	want := &AccessToken{
+		Token:     token,
+		ExpiresAt: time.Date(2016, 7, 11, 22, 14, 10, 0, time.UTC),
+		Permissions: github.InstallationPermissions{
+			Contents: github.String("read"),
+		},
+		Repositories: []github.Repository{{ID: github.Int64(1234)}},
+	}
+
+	b, err := MarshalAccessToken(want)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	got, err := UnmarshalAccessToken(b)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("token want->got: %s", diff)
+	}
+}
+
+func TestUnmarshalAccessToken(t *testing.T) {
+	tests := map[string]struct {
+		data    string
+		wantErr bool
+	}{
+		"unversioned": {
+			data: `{"token": "abc123", "expires_at": "2016-07-11T22:14:10Z"}`,
+		},
+		"current": {
+			data: `{"version": 1, "min_version": 1, "token": "abc123", "expires_at": "2016-07-11T22:14:10Z"}`,
+		},
+		"newer compatible": {
+			data: `{"version": 2, "min_version": 1, "token": "abc123", "expires_at": "2016-07-11T22:14:10Z", "new_field": true}`,
+		},
+		"newer incompatible": {
+			data:    `{"version": 3, "min_version": 3, "token": "abc123", "expires_at": "2016-07-11T22:14:10Z"}`,
+			wantErr: true,
+		},
+		"missing token": {
+			data:    `{"version": 1, "expires_at": "2016-07-11T22:14:10Z"}`,
+			wantErr: true,
+		},
+		"corrupt": {
+			data:    `{"version": 1, "tok`,
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := UnmarshalAccessToken([]byte(test.data))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("UnmarshalAccessToken() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			if got.Token != token {
+				t.Errorf("Token = %q, want %q", got.Token, token)
+			}
+		})
+	}
+}
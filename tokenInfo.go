@@ -0,0 +1,94 @@
+package ghinstallation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v38/github"
+)
+
+// TokenInfo describes the installation access token a Transport
+// authenticated a request with, for attributing API calls to credentials in
+// audit logs or while debugging. It's filled in by the Transport when a
+// request's context was returned by WithTokenInfo:
+//
+//	var info ghinstallation.TokenInfo
+//	req = req.WithContext(ghinstallation.WithTokenInfo(req.Context(), &info))
+//	resp, err := client.Do(req)
+//	log.Printf("used token %v of installation %v", info.Fingerprint(), info.InstallationID())
+//
+// If the request is redirected, TokenInfo describes the token of the last
+// authenticated request. It's zero if no request was authenticated, such as
+// when the token couldn't be refreshed.
+type TokenInfo struct {
+	mu             sync.Mutex // mu protects the fields below, as requests may be sent on other goroutines
+	installationID int64
+	token          *AccessToken
+}
+
+// tokenInfoKey is the context key for the TokenInfo set by WithTokenInfo.
+type tokenInfoKey struct{}
+
+// WithTokenInfo returns a copy of ctx which causes Transports to fill in info
+// with the token they authenticate requests using ctx with.
+func WithTokenInfo(ctx context.Context, info *TokenInfo) context.Context {
+	return context.WithValue(ctx, tokenInfoKey{}, info)
+}
+
+func (i *TokenInfo) set(installationID int64, token *AccessToken) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.installationID, i.token = installationID, token
+}
+
+// InstallationID returns the ID of the installation the token belongs to.
+func (i *TokenInfo) InstallationID() int64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.installationID
+}
+
+// ExpiresAt returns when the token expires.
+func (i *TokenInfo) ExpiresAt() time.Time {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.token == nil {
+		return time.Time{}
+	}
+	return i.token.ExpiresAt
+}
+
+// Permissions returns the permissions granted to the token.
+func (i *TokenInfo) Permissions() github.InstallationPermissions {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.token == nil {
+		return github.InstallationPermissions{}
+	}
+	return i.token.Permissions
+}
+
+// Repositories returns the repositories the token was restricted to, if any.
+func (i *TokenInfo) Repositories() []github.Repository {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.token == nil {
+		return nil
+	}
+	return i.token.Repositories
+}
+
+// Fingerprint returns a short hash identifying the token, which can be
+// logged without revealing it. It's empty if there's no token.
+func (i *TokenInfo) Fingerprint() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.token == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(i.token.Token))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,57 @@
+package ghinstallation
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v38/github"
+)
+
+func TestTokenInfo(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	other := &AccessToken{Token: "def456", ExpiresAt: expiresAt}
+	ts := TokenSourceFunc(func(ctx context.Context, id int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+		if id == installationID+1 {
+			return other, nil
+		}
+		return &AccessToken{
+			Token:       token,
+			ExpiresAt:   expiresAt,
+			Permissions: github.InstallationPermissions{Contents: github.String("read")},
+		}, nil
+	})
+	tr := NewFromTokenSource(RoundTrip{rt: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}}, installationID, ts)
+
+	var info TokenInfo
+	if info.Fingerprint() != "" || info.InstallationID() != 0 {
+		t.Error("unused TokenInfo isn't zero")
+	}
+
+	req, _ := http.NewRequest("GET", "https://api.github.com/repos/o/r", nil)
+	req = req.WithContext(WithTokenInfo(req.Context(), &info))
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if info.InstallationID() != installationID || !info.ExpiresAt().Equal(expiresAt) || info.Permissions().Contents == nil {
+		t.Errorf("unexpected TokenInfo for installation %v expiring at %v with permissions %v", info.InstallationID(), info.ExpiresAt(), info.Permissions())
+	}
+	fingerprint := info.Fingerprint()
+	if fingerprint == "" || strings.Contains(fingerprint, token) {
+		t.Errorf("unexpected fingerprint %q", fingerprint)
+	}
+
+	req, _ = http.NewRequest("GET", "https://api.github.com/repos/o/r", nil)
+	req = req.WithContext(WithTokenInfo(WithInstallationID(req.Context(), installationID+1), &info))
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if info.InstallationID() != installationID+1 || info.Fingerprint() == fingerprint {
+		t.Errorf("TokenInfo wasn't updated for installation %v", installationID+1)
+	}
+}
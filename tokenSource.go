@@ -0,0 +1,116 @@
+package ghinstallation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v38/github"
+)
+
+// TokenSource provides installation access tokens.
+//
+// Implementations must be safe for concurrent use.
+type TokenSource interface {
+	// Token returns an access token for the installation, restricted by
+	// opts if it's non-nil.
+	Token(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error)
+}
+
+var _ TokenSource = &AppsTransport{}
+
+// Token implements TokenSource by minting a new access token for the
+// installation on every call. Use ReuseTokenSource to reuse tokens until they
+// expire.
+func (t *AppsTransport) Token(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+	u := accessTokensURL(t.BaseURL, t.AccessTokensURL, installationID)
+	return mintToken(ctx, t.Client, t, u, installationID, opts)
+}
+
+// ReuseTokenSource returns a TokenSource which reuses tokens obtained from
+// src until they're about to expire. Tokens are cached per installation and
+// token options, and concurrent requests for the same token only obtain it
+// from src once.
+func ReuseTokenSource(src TokenSource) TokenSource {
+	return &reuseTokenSource{
+		src:    src,
+		tokens: make(map[string]*reuseEntry),
+	}
+}
+
+type reuseTokenSource struct {
+	src TokenSource
+
+	mu     sync.Mutex             // mu protects tokens
+	tokens map[string]*reuseEntry // tokens are the cached tokens by tokenCacheKey
+}
+
+type reuseEntry struct {
+	mu    sync.Mutex // mu protects token
+	token *AccessToken
+}
+
+// Token implements TokenSource.
+func (s *reuseTokenSource) Token(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+	key, err := tokenCacheKey(installationID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	entry, ok := s.tokens[key]
+	if !ok {
+		entry = &reuseEntry{}
+		s.tokens[key] = entry
+	}
+	s.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.token != nil && entry.token.ExpiresAt.Add(-time.Minute).After(time.Now()) {
+		cacheHitsVar.Add(1)
+		return entry.token, nil
+	}
+	token, err := s.src.Token(ctx, installationID, opts)
+	if err != nil {
+		return nil, err
+	}
+	entry.token = token
+	return entry.token, nil
+}
+
+// StaticTokenSource returns a TokenSource which always returns token, such
+// as one minted elsewhere and handed to this process, until it expires. Once
+// it has expired a *TokenExpiredError is returned.
+//
+// The token is returned regardless of the installation and options requested.
+func StaticTokenSource(token *AccessToken) TokenSource {
+	return staticTokenSource{token: token}
+}
+
+type staticTokenSource struct {
+	token *AccessToken
+}
+
+// Token implements TokenSource.
+func (s staticTokenSource) Token(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+	if !s.token.ExpiresAt.After(time.Now()) {
+		return nil, &TokenExpiredError{
+			InstallationID: installationID,
+			ExpiresAt:      s.token.ExpiresAt,
+		}
+	}
+	return s.token, nil
+}
+
+// TokenExpiredError is returned when a token which cannot be refreshed, such
+// as one from StaticTokenSource, has expired.
+type TokenExpiredError struct {
+	InstallationID int64
+	ExpiresAt      time.Time
+}
+
+func (e *TokenExpiredError) Error() string {
+	return fmt.Sprintf("installation ID %v's token expired at %v", e.InstallationID, e.ExpiresAt)
+}
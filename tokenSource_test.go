@@ -0,0 +1,156 @@
+package ghinstallation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v38/github"
+)
+
+type TokenSourceFunc func(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+	return f(ctx, installationID, opts)
+}
+
+func TestAppsTransportToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.RequestURI != fmt.Sprintf("/app/installations/%d/access_tokens", installationID) {
+			t.Fatalf("unexpected URI: %q", r.RequestURI)
+		}
+		fmt.Fprintf(w, `{"token": %q, "expires_at": "2016-07-11T22:14:10Z"}`, token)
+	}))
+	defer ts.Close()
+
+	atr, err := NewAppsTransport(&http.Transport{}, appID, key)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	atr.BaseURL = ts.URL
+
+	got, err := atr.Token(context.Background(), installationID, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got.Token != token {
+		t.Errorf("Token() = %q, want %q", got.Token, token)
+	}
+}
+
+func TestReuseTokenSource(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[int64]int)
+	src := TokenSourceFunc(func(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[installationID]++
+		return &AccessToken{
+			Token:     fmt.Sprintf("token-%d-%d", installationID, calls[installationID]),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}, nil
+	})
+	ts := ReuseTokenSource(src)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ts.Token(context.Background(), 1, nil); err != nil {
+				t.Error("unexpected error:", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls[1] != 1 {
+		t.Errorf("source called %d times for installation 1, want 1", calls[1])
+	}
+
+	got, err := ts.Token(context.Background(), 2, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got.Token != "token-2-1" {
+		t.Errorf("Token() = %q, want %q", got.Token, "token-2-1")
+	}
+
+	// Different options require a different token.
+	opts := &github.InstallationTokenOptions{RepositoryIDs: []int64{1234}}
+	if _, err := ts.Token(context.Background(), 1, opts); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if calls[1] != 2 {
+		t.Errorf("source called %d times for installation 1, want 2", calls[1])
+	}
+
+	// Nearly expired tokens are replaced.
+	key, _ := tokenCacheKey(2, nil)
+	ts.(*reuseTokenSource).tokens[key].token.ExpiresAt = time.Now()
+	got, err = ts.Token(context.Background(), 2, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got.Token != "token-2-2" {
+		t.Errorf("Token() = %q, want %q", got.Token, "token-2-2")
+	}
+}
+
+func TestNewFromTokenSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want := "token " + r.URL.Query().Get("installation"); r.Header.Get("Authorization") != want {
+			t.Errorf("Authorization got: %q want: %q", r.Header.Get("Authorization"), want)
+		}
+	}))
+	defer ts.Close()
+
+	src := ReuseTokenSource(TokenSourceFunc(func(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*AccessToken, error) {
+		return &AccessToken{
+			Token:     fmt.Sprint(installationID),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}, nil
+	}))
+
+	shared := &http.Transport{}
+	for _, id := range []int64{1, 2} {
+		client := http.Client{Transport: NewFromTokenSource(shared, id, src)}
+		if _, err := client.Get(fmt.Sprintf("%s/?installation=%d", ts.URL, id)); err != nil {
+			t.Fatal("unexpected error from client:", err)
+		}
+	}
+}
+
+func TestNewFromAccessToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want := "token " + token; r.Header.Get("Authorization") != want {
+			t.Errorf("Authorization got: %q want: %q", r.Header.Get("Authorization"), want)
+		}
+	}))
+	defer ts.Close()
+
+	// Tokens are used right up until they expire, even if they'd usually be
+	// refreshed.
+	tr := NewFromAccessToken(&http.Transport{}, installationID, &AccessToken{
+		Token:     token,
+		ExpiresAt: time.Now().Add(30 * time.Second),
+	})
+	client := http.Client{Transport: tr}
+	if _, err := client.Get(ts.URL); err != nil {
+		t.Fatal("unexpected error from client:", err)
+	}
+
+	tr.token.ExpiresAt = time.Now().Add(-time.Second)
+	_, err := client.Get(ts.URL)
+	var eerr *TokenExpiredError
+	if !errors.As(err, &eerr) {
+		t.Fatalf("client.Get() err = %v, want TokenExpiredError", err)
+	}
+	if eerr.InstallationID != installationID {
+		t.Errorf("InstallationID = %v, want %v", eerr.InstallationID, installationID)
+	}
+}
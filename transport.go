@@ -4,12 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/go-github/v38/github"
 )
@@ -30,18 +37,54 @@ const (
 type Transport struct {
 	BaseURL                  string                           // BaseURL is the scheme and host for GitHub API, defaults to https://api.github.com
 	Client                   Client                           // Client to use to refresh tokens, defaults to http.Client with provided transport
+	AccessTokensURL          string                           // AccessTokensURL overrides the URL to mint tokens from, "{id}" is replaced by the installation ID, defaults to BaseURL's
+	AcceptHeaderMode         AcceptHeaderMode                 // AcceptHeaderMode controls how requests' Accept header is set, defaults to adding GitHub's media type
 	tr                       http.RoundTripper                // tr is the underlying roundtripper being wrapped
 	appID                    int64                            // appID is the GitHub App's ID
 	installationID           int64                            // installationID is the GitHub App Installation ID
 	InstallationTokenOptions *github.InstallationTokenOptions // parameters restrict a token's access
+	CheckSuspended           bool                             // CheckSuspended looks up the Transport's installation before minting and fails fast if it is suspended
+	APIVersion               string                           // APIVersion is sent as the X-GitHub-Api-Version header if set, failing with a *CapabilityError on GitHub Enterprise Server older than 3.9
 	appsTransport            *AppsTransport
+	tokenSource              TokenSource // tokenSource provides tokens instead of appsTransport, if set
 
-	mu    *sync.Mutex  // mu protects token
-	token *accessToken // token is the installation's access token
+	mu                    *sync.Mutex            // mu protects token, installation and health
+	token                 *AccessToken           // token is the installation's access token
+	tokens                map[int64]*AccessToken // tokens are other installations' access tokens, see WithInstallationID
+	installation          *github.Installation   // installation is the last looked up installation, used by CheckSuspended
+	installationCheckedAt time.Time              // installationCheckedAt is when installation was looked up
+	optsBody              []byte                 // optsBody is optsBodyOf encoded by WithInstallationTokenOptions
+	optsBodyOf            *github.InstallationTokenOptions
+	eagerCtx              context.Context // eagerCtx is set by WithEagerToken until the first token is minted
+	lastRefresh           time.Time       // lastRefresh is when token was last refreshed
+	lastError             error           // lastError is the error refreshing token since lastRefresh, if any
+	lastErrorAt           time.Time
+
+	versionMu        sync.Mutex // versionMu protects the server version, it's never held while obtaining a token
+	serverVersion    string     // serverVersion is the GitHub Enterprise Server version, see ServerVersion
+	serverVersionErr error      // serverVersionErr is why serverVersion couldn't be fetched
+	serverVersionAt  time.Time  // serverVersionAt is when serverVersion was fetched
 }
 
-// accessToken is an installation access token response from GitHub
-type accessToken struct {
+// installationCheckTTL is how long a looked up installation is reused by
+// CheckSuspended before it's fetched again.
+const installationCheckTTL = 5 * time.Minute
+
+const (
+	// mintAttempts is the number of times minting a token is attempted if
+	// it fails due to transient network errors.
+	mintAttempts = 3
+	// mintRetryWait is how long to wait before the first retry, doubling for
+	// each subsequent retry.
+	mintRetryWait = 100 * time.Millisecond
+)
+
+// maxBodyDrain is the most of a response body read to allow its connection to
+// be reused.
+const maxBodyDrain = 64 << 10
+
+// AccessToken is an installation access token response from GitHub.
+type AccessToken struct {
 	Token        string                         `json:"token"`
 	ExpiresAt    time.Time                      `json:"expires_at"`
 	Permissions  github.InstallationPermissions `json:"permissions,omitempty"`
@@ -56,21 +99,115 @@ type HTTPError struct {
 	RootCause      error
 	InstallationID int64
 	Response       *http.Response
+	body           []byte // body is the buffered body of Response
 }
 
 func (e *HTTPError) Error() string {
 	return e.Message
 }
 
+// maxErrorBodyJSON is the most of an HTTPError's response body included in its
+// JSON encoding.
+const maxErrorBodyJSON = 1024
+
+// MarshalJSON implements json.Marshaler, encoding the error's response status,
+// URL, GitHub request ID and up to 1KiB of the response body for inclusion in
+// error responses or structured logs.
+//
+// The URL's query and user info are removed, and the request, root cause and
+// message aren't included, so the encoding doesn't contain credentials.
+func (e *HTTPError) MarshalJSON() ([]byte, error) {
+	v := struct {
+		StatusCode     int    `json:"status_code,omitempty"`
+		URL            string `json:"url,omitempty"`
+		InstallationID int64  `json:"installation_id,omitempty"`
+		RequestID      string `json:"request_id,omitempty"`
+		Body           string `json:"body,omitempty"`
+		BodyTruncated  bool   `json:"body_truncated,omitempty"`
+	}{
+		InstallationID: e.InstallationID,
+	}
+	if e.Response != nil {
+		v.StatusCode = e.Response.StatusCode
+		v.RequestID = e.Response.Header.Get("X-GitHub-Request-Id")
+		if e.Response.Request != nil && e.Response.Request.URL != nil {
+			u := *e.Response.Request.URL
+			u.User, u.RawQuery, u.ForceQuery, u.Fragment = nil, "", false, ""
+			v.URL = u.String()
+		}
+	}
+	body := e.body
+	if len(body) > maxErrorBodyJSON {
+		body = body[:maxErrorBodyJSON]
+		// Don't split a multibyte character at the end, other invalid bytes
+		// are replaced when encoding.
+		for i := len(body) - 1; i >= 0 && i > len(body)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(body[i]) {
+				if !utf8.FullRune(body[i:]) {
+					body = body[:i]
+				}
+				break
+			}
+		}
+		v.BodyTruncated = true
+	}
+	v.Body = string(body)
+	return json.Marshal(v)
+}
+
+// InstallationSuspendedError is returned when CheckSuspended is set and the
+// installation has been suspended, in which case GitHub would refuse to mint
+// a token.
+type InstallationSuspendedError struct {
+	InstallationID int64
+	SuspendedAt    time.Time
+	SuspendedBy    string // SuspendedBy is the login of the user who suspended the installation, if known
+}
+
+func (e *InstallationSuspendedError) Error() string {
+	msg := fmt.Sprintf("installation ID %v was suspended at %v", e.InstallationID, e.SuspendedAt)
+	if e.SuspendedBy != "" {
+		msg += " by " + e.SuspendedBy
+	}
+	return msg
+}
+
 var _ http.RoundTripper = &Transport{}
 
+// AcceptHeaderMode controls how a Transport or AppsTransport sets the Accept
+// header of requests.
+type AcceptHeaderMode int
+
+const (
+	// AcceptHeaderAdd adds GitHub's media type to the request's Accept
+	// header, keeping any existing values.
+	AcceptHeaderAdd AcceptHeaderMode = iota
+	// AcceptHeaderIfUnset sets GitHub's media type as the request's Accept
+	// header if it doesn't already have one.
+	AcceptHeaderIfUnset
+	// AcceptHeaderNone leaves the request's Accept header untouched.
+	AcceptHeaderNone
+)
+
+// setAcceptHeader sets the Accept header in h according to mode.
+func setAcceptHeader(h http.Header, mode AcceptHeaderMode) {
+	switch mode {
+	case AcceptHeaderAdd:
+		h.Add("Accept", acceptHeader) // We add to "Accept" header to avoid overwriting existing req headers.
+	case AcceptHeaderIfUnset:
+		if h.Get("Accept") == "" {
+			h.Set("Accept", acceptHeader)
+		}
+	}
+}
+
 // NewKeyFromFile returns a Transport using a private key from file.
-func NewKeyFromFile(tr http.RoundTripper, appID, installationID int64, privateKeyFile string) (*Transport, error) {
+func NewKeyFromFile(tr http.RoundTripper, appID, installationID int64, privateKeyFile string, opts ...Option) (*Transport, error) {
 	privateKey, err := ioutil.ReadFile(privateKeyFile)
 	if err != nil {
 		return nil, fmt.Errorf("could not read private key: %s", err)
 	}
-	return New(tr, appID, installationID, privateKey)
+	return New(tr, appID, installationID, privateKey, opts...)
 }
 
 // Client is a HTTP client which sends a http.Request and returns a http.Response
@@ -86,54 +223,272 @@ type Client interface {
 // installations to ensure reuse of underlying TCP connections.
 //
 // The returned Transport's RoundTrip method is safe to be used concurrently.
-func New(tr http.RoundTripper, appID, installationID int64, privateKey []byte) (*Transport, error) {
+func New(tr http.RoundTripper, appID, installationID int64, privateKey []byte, opts ...Option) (*Transport, error) {
 	atr, err := NewAppsTransport(tr, appID, privateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewFromAppsTransport(atr, installationID), nil
+	t := NewFromAppsTransport(atr, installationID)
+	if err := t.apply(opts); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Option configures a Transport.
+type Option func(*Transport)
+
+// apply configures t with opts, then mints its first token if WithEagerToken
+// was used.
+func (t *Transport) apply(opts []Option) error {
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.eagerCtx == nil {
+		return nil
+	}
+	ctx := t.eagerCtx
+	t.eagerCtx = nil
+	if _, err := t.Token(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WithEagerToken mints the Transport's first token when it's created, so
+// misconfigured credentials, such as the wrong app or installation ID, fail
+// its construction rather than its first request. The token is cached for
+// subsequent requests.
+func WithEagerToken(ctx context.Context) Option {
+	return func(t *Transport) {
+		t.eagerCtx = ctx
+	}
+}
+
+// WithInstallationTokenOptions restricts the access of the Transport's tokens,
+// see Transport.InstallationTokenOptions.
+//
+// opts are encoded once rather than for every token minted, so they must not
+// be modified afterwards. Assigning the Transport's InstallationTokenOptions
+// instead encodes them for each token, so they may be modified.
+func WithInstallationTokenOptions(opts *github.InstallationTokenOptions) Option {
+	return func(t *Transport) {
+		t.InstallationTokenOptions = opts
+		// If they can't be encoded, the error is returned when minting.
+		t.optsBody, _ = encodeBody(opts)
+		t.optsBodyOf = opts
+	}
 }
 
 // NewFromAppsTransport returns a Transport using an existing *AppsTransport.
 func NewFromAppsTransport(atr *AppsTransport, installationID int64) *Transport {
 	return &Transport{
-		BaseURL:        atr.BaseURL,
-		Client:         &http.Client{Transport: atr.tr},
-		tr:             atr.tr,
-		appID:          atr.appID,
+		BaseURL:         atr.BaseURL,
+		Client:          &http.Client{Transport: atr.tr},
+		AccessTokensURL: atr.AccessTokensURL,
+		tr:              atr.tr,
+		appID:           atr.appID,
+		installationID:  installationID,
+		appsTransport:   atr,
+		mu:              &sync.Mutex{},
+	}
+}
+
+// NewFromTokenSource returns a Transport which obtains its installation's
+// tokens from ts, such as one returned by ReuseTokenSource. This allows many
+// Transports, one per installation, to share a single TokenSource.
+//
+// Minting tokens is left to ts, so the returned Transport's BaseURL, Client
+// and CheckSuspended are not used for it.
+func NewFromTokenSource(tr http.RoundTripper, installationID int64, ts TokenSource) *Transport {
+	return &Transport{
+		BaseURL:        apiBaseURL,
+		Client:         &http.Client{Transport: tr},
+		tr:             tr,
 		installationID: installationID,
-		appsTransport:  atr,
+		tokenSource:    ts,
 		mu:             &sync.Mutex{},
 	}
 }
 
+// NewFromAccessToken returns a Transport using an already minted installation
+// access token, such as one handed over by a token broker, without requiring
+// the app's private key. The token is used until it expires, after which
+// requests fail with a *TokenExpiredError.
+//
+// installationID is only used to report errors, and may be 0 if unknown.
+func NewFromAccessToken(tr http.RoundTripper, installationID int64, token *AccessToken) *Transport {
+	t := NewFromTokenSource(tr, installationID, StaticTokenSource(token))
+	t.token = token
+	return t
+}
+
 // RoundTrip implements http.RoundTripper interface.
+//
+// Requests following a redirect to a different host than the original
+// request, such as release asset downloads redirecting to storage hosts, are
+// sent without the installation's token. Redirects from the API to GitHub's
+// raw and codeload hosts, such as when downloading private repositories'
+// files and archives, are still authenticated.
+//
+// The token a request is authenticated with is described by the TokenInfo in
+// its context, if it was added using WithTokenInfo.
 func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	token, err := t.Token(req.Context())
-	if err != nil {
-		return nil, err
+	if isCrossHostRedirect(req) && !isGitHubRedirect(t.BaseURL, req) {
+		req.Header.Del("Authorization")
+	} else {
+		if t.APIVersion != "" {
+			if err := t.requireCapability(req.Context(), CapabilityAPIVersionHeader); err != nil {
+				return nil, err
+			}
+			req.Header.Set("X-GitHub-Api-Version", t.APIVersion)
+		}
+		token, err := t.accessToken(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "token "+token.Token)
+		if info, ok := req.Context().Value(tokenInfoKey{}).(*TokenInfo); ok {
+			info.set(t.contextInstallationID(req.Context()), token)
+		}
 	}
-
-	req.Header.Set("Authorization", "token "+token)
-	req.Header.Add("Accept", acceptHeader) // We add to "Accept" header to avoid overwriting existing req headers.
+	setAcceptHeader(req.Header, t.AcceptHeaderMode)
 	resp, err := t.tr.RoundTrip(req)
 	return resp, err
 }
 
+// CloseIdleConnections closes idle connections of the underlying
+// http.RoundTripper and Client, if they support it, such as when shutting
+// down. It's called by http.Client's CloseIdleConnections.
+func (t *Transport) CloseIdleConnections() {
+	closeIdleConnections(t.tr)
+	closeIdleConnections(t.Client)
+}
+
+// closeIdleConnections closes v's idle connections if it supports it, as
+// http.RoundTrippers such as *http.Transport and Clients such as *http.Client
+// do.
+func closeIdleConnections(v interface{}) {
+	if c, ok := v.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// isCrossHostRedirect returns whether req follows a redirect to a different
+// host than the request which started the redirects.
+func isCrossHostRedirect(req *http.Request) bool {
+	return redirectOrigin(req).URL.Host != req.URL.Host
+}
+
+// isGitHubRedirect returns whether req follows a redirect between the hosts
+// serving GitHub's API and repository contents for baseURL.
+func isGitHubRedirect(baseURL string, req *http.Request) bool {
+	hosts := githubHosts(baseURL)
+	return hosts[redirectOrigin(req).URL.Host] && hosts[req.URL.Host]
+}
+
+// redirectOrigin returns the request which started the redirects req follows,
+// or req if it's not following a redirect.
+func redirectOrigin(req *http.Request) *http.Request {
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+	}
+	return req
+}
+
+// githubHosts returns the hosts serving GitHub's API, raw files and archives
+// for the API at baseURL. GitHub Enterprise Server serves raw files and
+// archives from the raw and codeload subdomains when subdomain isolation is
+// enabled, and from its own host otherwise.
+func githubHosts(baseURL string) map[string]bool {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil
+	}
+	if u.Host == "api.github.com" {
+		return map[string]bool{
+			"api.github.com":            true,
+			"raw.githubusercontent.com": true,
+			"codeload.github.com":       true,
+		}
+	}
+	return map[string]bool{
+		u.Host:               true,
+		"raw." + u.Host:      true,
+		"codeload." + u.Host: true,
+	}
+}
+
 // Token checks the active token expiration and renews if necessary. Token returns
 // a valid access token. If renewal fails an error is returned.
 func (t *Transport) Token(ctx context.Context) (string, error) {
+	token, err := t.accessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	return token.Token, nil
+}
+
+// accessToken returns a valid access token for the installation requested by
+// ctx, renewing it if necessary.
+func (t *Transport) accessToken(ctx context.Context) (*AccessToken, error) {
+	installationID := t.contextInstallationID(ctx)
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	if t.token == nil || t.token.ExpiresAt.Add(-time.Minute).Before(time.Now()) {
+	token := t.token
+	if installationID != t.installationID {
+		token = t.tokens[installationID]
+	}
+	if token != nil && token.ExpiresAt.Add(-time.Minute).After(time.Now()) {
+		cacheHitsVar.Add(1)
+	} else {
 		// Token is not set or expired/nearly expired, so refresh
-		if err := t.refreshToken(ctx); err != nil {
-			return "", fmt.Errorf("could not refresh installation id %v's token: %w", t.installationID, err)
+		var err error
+		if token, err = t.refreshToken(ctx, installationID); err != nil {
+			if installationID == t.installationID {
+				t.lastError, t.lastErrorAt = err, time.Now()
+			}
+			return nil, fmt.Errorf("could not refresh installation id %v's token: %w", installationID, err)
+		}
+		if installationID == t.installationID {
+			t.token = token
+			t.lastRefresh, t.lastError = time.Now(), nil
+		} else {
+			if t.tokens == nil {
+				t.tokens = make(map[int64]*AccessToken)
+			}
+			t.tokens[installationID] = token
 		}
 	}
 
-	return t.token.Token, nil
+	return token, nil
+}
+
+// contextInstallationID returns the installation ID set by WithInstallationID,
+// or the Transport's installation ID if there's none.
+func (t *Transport) contextInstallationID(ctx context.Context) int64 {
+	if ctx != nil {
+		if id, ok := ctx.Value(installationIDKey{}).(int64); ok {
+			return id
+		}
+	}
+	return t.installationID
+}
+
+// installationIDKey is the context key for the installation ID set by
+// WithInstallationID.
+type installationIDKey struct{}
+
+// WithInstallationID returns a copy of ctx which causes requests using it to
+// be authenticated as installationID, instead of the Transport's installation.
+// This allows a single Transport to occasionally make requests on behalf of
+// another installation of the same GitHub App.
+//
+// Tokens for other installations are cached separately by the Transport.
+func WithInstallationID(ctx context.Context, installationID int64) context.Context {
+	return context.WithValue(ctx, installationIDKey{}, installationID)
 }
 
 // Permissions returns a transport token's GitHub installation permissions.
@@ -152,49 +507,276 @@ func (t *Transport) Repositories() ([]github.Repository, error) {
 	return t.token.Repositories, nil
 }
 
-func (t *Transport) refreshToken(ctx context.Context) error {
-	// Convert InstallationTokenOptions into a ReadWriter to pass as an argument to http.NewRequest.
-	body, err := GetReadWriter(t.InstallationTokenOptions)
+// ListRepositories returns all repositories accessible to the installation's
+// token, paging through GET /installation/repositories. Unlike Repositories,
+// it is not limited to repositories the token was restricted to when it was
+// minted.
+func (t *Transport) ListRepositories(ctx context.Context) ([]*github.Repository, error) {
+	client, err := newGitHubClient(t.BaseURL, t)
 	if err != nil {
-		return fmt.Errorf("could not convert installation token parameters into json: %s", err)
+		return nil, err
+	}
+
+	var repos []*github.Repository
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		list, resp, err := client.Apps.ListRepos(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("could not list installation id %v's repositories: %w", t.contextInstallationID(ctx), err)
+		}
+		repos = append(repos, list.Repositories...)
+		if resp.NextPage == 0 {
+			return repos, nil
+		}
+		opts.Page = resp.NextPage
 	}
+}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/app/installations/%v/access_tokens", t.BaseURL, t.installationID), body)
+// scopedTokenOptions restricts a token's access by repository name, which
+// github.InstallationTokenOptions doesn't support.
+type scopedTokenOptions struct {
+	Repositories []string                        `json:"repositories,omitempty"`
+	Permissions  *github.InstallationPermissions `json:"permissions,omitempty"`
+}
+
+// MintScopedToken mints a new token for the installation, restricted to the
+// named repositories and perms if they're non-nil, such as for handing to
+// subprocesses or third party tools with least privilege. The token is not
+// cached or used by the Transport.
+//
+// Minting tokens requires the app's private key, so MintScopedToken fails for
+// Transports created using NewFromTokenSource or NewFromAccessToken.
+func (t *Transport) MintScopedToken(ctx context.Context, repos []string, perms *github.InstallationPermissions) (*AccessToken, error) {
+	if t.appsTransport == nil {
+		return nil, fmt.Errorf("could not mint scoped token: transport has no app credentials")
+	}
+
+	installationID := t.contextInstallationID(ctx)
+	u := accessTokensURL(t.BaseURL, t.AccessTokensURL, installationID)
+	opts := &scopedTokenOptions{Repositories: repos, Permissions: perms}
+	token, err := mintToken(ctx, t.Client, t.appsTransport, u, installationID, opts)
 	if err != nil {
-		return fmt.Errorf("could not create request: %s", err)
+		return nil, fmt.Errorf("could not mint installation id %v's scoped token: %w", installationID, err)
+	}
+	return token, nil
+}
+
+func (t *Transport) refreshToken(ctx context.Context, installationID int64) (*AccessToken, error) {
+	if t.tokenSource != nil {
+		return t.tokenSource.Token(ctx, installationID, t.InstallationTokenOptions)
 	}
 
-	// Set Content and Accept headers.
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
+	if t.CheckSuspended && installationID == t.installationID {
+		if err := t.checkSuspended(ctx); err != nil {
+			return nil, err
+		}
 	}
-	req.Header.Set("Accept", acceptHeader)
 
-	if ctx != nil {
-		req = req.WithContext(ctx)
+	var opts interface{} = t.InstallationTokenOptions
+	if t.optsBody != nil && t.optsBodyOf == t.InstallationTokenOptions {
+		opts = t.optsBody
+	}
+	u := accessTokensURL(t.BaseURL, t.AccessTokensURL, installationID)
+	return mintToken(ctx, t.Client, t.appsTransport, u, installationID, opts)
+}
+
+// accessTokensURL returns the URL to mint the installation's tokens from, using
+// template if it's set.
+func accessTokensURL(baseURL, template string, installationID int64) string {
+	if template == "" {
+		return fmt.Sprintf("%s/app/installations/%v/access_tokens", baseURL, installationID)
+	}
+	return strings.Replace(template, "{id}", strconv.FormatInt(installationID, 10), -1)
+}
+
+// mintToken requests a new access token for the installation from url using
+// client, authenticating as the app using atr if it's non-nil. As minting is
+// idempotent, requests failing due to transient network errors are retried.
+//
+// opts are encoded as JSON, unless they're already encoded as a []byte.
+func mintToken(ctx context.Context, client Client, atr *AppsTransport, url string, installationID int64, opts interface{}) (*AccessToken, error) {
+	b, err := encodeBody(opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert installation token parameters into json: %s", err)
+	}
+
+	var (
+		req  *http.Request
+		resp *http.Response
+		wait = mintRetryWait
+	)
+	for attempt := 1; ; attempt++ {
+		req, err = http.NewRequest("POST", url, bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("could not create request: %s", err)
+		}
+
+		// Set Content and Accept headers.
+		if b != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Accept", acceptHeader)
+
+		if ctx != nil {
+			req = req.WithContext(ctx)
+		}
+
+		if atr != nil {
+			resp, err = atr.do(client, req)
+		} else {
+			resp, err = client.Do(req)
+		}
+		if err == nil || attempt == mintAttempts || !isTransientNetError(err) || req.Context().Err() != nil {
+			break
+		}
+
+		select {
+		case <-req.Context().Done():
+		case <-time.After(wait):
+		}
+		wait *= 2
 	}
 
-	t.appsTransport.BaseURL = t.BaseURL
-	t.appsTransport.Client = t.Client
-	resp, err := t.appsTransport.RoundTrip(req)
 	e := &HTTPError{
 		RootCause:      err,
-		InstallationID: t.installationID,
+		InstallationID: installationID,
 		Response:       resp,
 	}
+	if err != nil || resp.StatusCode/100 != 2 {
+		recordMint(installationID, nil, e)
+	}
 	if err != nil {
-		e.Message = fmt.Sprintf("could not get access_tokens from GitHub API for installation ID %v: %v", t.installationID, err)
-		return e
+		e.Message = fmt.Sprintf("could not get access_tokens from GitHub API for installation ID %v: %v", installationID, err)
+		return nil, e
 	}
 
 	if resp.StatusCode/100 != 2 {
+		// Buffer the body, to provide caller a chance to inspect body in an error / non-200 response status situation
+		e.body = bufferBody(resp)
 		e.Message = fmt.Sprintf("received non 2xx response status %q when fetching %v", resp.Status, req.URL)
-		return e
+		return nil, e
+	}
+	defer closeBody(resp.Body)
+
+	var token *AccessToken
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err == nil && (token == nil || token.Token == "") {
+		// Such as from a broker or gateway responding with null.
+		err = fmt.Errorf("no token in response from %v", req.URL)
+	}
+	recordMint(installationID, token, err)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// isTransientNetError returns whether err is a network error which is likely
+// to succeed if the request is retried, such as a connection being reset.
+func isTransientNetError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// The server closed a kept-alive connection as it was being reused.
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	return false
+}
+
+// checkSuspended looks up the installation, reusing a recent lookup if
+// available, and returns an *InstallationSuspendedError if it is suspended.
+func (t *Transport) checkSuspended(ctx context.Context) error {
+	if t.installation == nil || time.Since(t.installationCheckedAt) > installationCheckTTL {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/app/installations/%v", t.BaseURL, t.installationID), nil)
+		if err != nil {
+			return fmt.Errorf("could not create request: %s", err)
+		}
+		req.Header.Set("Accept", acceptHeader)
+
+		if ctx != nil {
+			req = req.WithContext(ctx)
+		}
+
+		resp, err := t.appsTransport.do(t.Client, req)
+		e := &HTTPError{
+			RootCause:      err,
+			InstallationID: t.installationID,
+			Response:       resp,
+		}
+		if err != nil {
+			e.Message = fmt.Sprintf("could not get installation from GitHub API for installation ID %v: %v", t.installationID, err)
+			return e
+		}
+
+		if resp.StatusCode/100 != 2 {
+			e.body = bufferBody(resp)
+			e.Message = fmt.Sprintf("received non 2xx response status %q when fetching %v", resp.Status, req.URL)
+			return e
+		}
+		defer closeBody(resp.Body)
+
+		var installation github.Installation
+		if err := json.NewDecoder(resp.Body).Decode(&installation); err != nil {
+			return fmt.Errorf("could not decode installation: %s", err)
+		}
+		t.installation = &installation
+		t.installationCheckedAt = time.Now()
+	}
+
+	if t.installation.SuspendedAt != nil {
+		return &InstallationSuspendedError{
+			InstallationID: t.installationID,
+			SuspendedAt:    t.installation.GetSuspendedAt().Time,
+			SuspendedBy:    t.installation.GetSuspendedBy().GetLogin(),
+		}
 	}
-	// Closing body late, to provide caller a chance to inspect body in an error / non-200 response status situation
-	defer resp.Body.Close()
+	return nil
+}
+
+// closeBody drains and closes body, allowing the connection to be reused.
+// Overly large bodies are not drained, and the connection is closed instead.
+func closeBody(body io.ReadCloser) {
+	io.CopyN(ioutil.Discard, body, maxBodyDrain)
+	body.Close()
+}
 
-	return json.NewDecoder(resp.Body).Decode(&t.token)
+// bufferBody replaces resp's body with an in-memory copy of up to
+// maxBodyDrain bytes, closing the original so its connection can be reused
+// while the body remains available to inspect. The copy is returned.
+func bufferBody(resp *http.Response) []byte {
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodyDrain))
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b
+}
+
+// bufferPool pools the buffers request bodies are encoded into.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// encodeBody encodes i as a JSON request body, returning it unchanged if it's
+// already a []byte, or nil if it's nil.
+func encodeBody(i interface{}) ([]byte, error) {
+	switch i := i.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return i, nil
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+	buf.Reset()
+	if err := json.NewEncoder(buf).Encode(i); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
 }
 
 // GetReadWriter converts a body interface into an io.ReadWriter object.
@@ -0,0 +1,114 @@
+// Package webhooks validates and parses webhooks delivered to GitHub Apps,
+// identifying the installation they were delivered for so they can be acted
+// on using the installation's token.
+//
+//	func handle(w http.ResponseWriter, r *http.Request) {
+//		event, err := webhooks.Parse(r, secret)
+//		if err != nil {
+//			http.Error(w, err.Error(), http.StatusBadRequest)
+//			return
+//		}
+//		token, err := event.Token(r.Context(), ts, nil)
+//		// ...
+//	}
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	sig "github.com/bradleyfalzon/ghinstallation/v2/internal/signature"
+	"github.com/google/go-github/v38/github"
+)
+
+// maxPayload is the most of a request's body read by Parse, GitHub caps
+// webhook payloads at 25MB.
+const maxPayload = 25 << 20
+
+var (
+	// ErrMissingSignature is returned when a webhook has no
+	// X-Hub-Signature-256 header, such as when the app has no webhook secret.
+	ErrMissingSignature = sig.ErrMissing
+	// ErrInvalidSignature is returned when a webhook's signature doesn't
+	// match its payload, so it wasn't sent by GitHub using the secret.
+	ErrInvalidSignature = sig.ErrInvalid
+	// ErrEmptySecret is returned when validating a webhook's signature using
+	// an empty secret, which anyone could forge signatures with, such as when
+	// the secret is read from an unset environment variable.
+	ErrEmptySecret = sig.ErrEmptySecret
+	// ErrNoInstallation is returned by Event.Token when the webhook wasn't
+	// delivered for an installation.
+	ErrNoInstallation = errors.New("webhook has no installation")
+)
+
+// Event is a webhook delivered by GitHub.
+type Event struct {
+	Type           string // Type is the event's name, such as "push", from the X-GitHub-Event header
+	DeliveryID     string // DeliveryID uniquely identifies the delivery, from the X-GitHub-Delivery header
+	InstallationID int64  // InstallationID is the installation the event was delivered for, or 0 if none
+	Payload        []byte // Payload is the event's JSON payload
+}
+
+// Parse validates r's X-Hub-Signature-256 header using the webhook secret and
+// returns the webhook's event. Either ErrMissingSignature or
+// ErrInvalidSignature is returned if the signature isn't valid.
+//
+// Parse reads r's body, which can't be read again afterwards.
+func Parse(r *http.Request, secret []byte) (*Event, error) {
+	payload, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPayload))
+	if err != nil {
+		return nil, fmt.Errorf("could not read webhook payload: %s", err)
+	}
+	if err := ValidateSignature(r.Header.Get("X-Hub-Signature-256"), payload, secret); err != nil {
+		return nil, err
+	}
+
+	event := &Event{
+		Type:       r.Header.Get("X-GitHub-Event"),
+		DeliveryID: r.Header.Get("X-GitHub-Delivery"),
+		Payload:    payload,
+	}
+	if event.Type == "" {
+		return nil, errors.New("missing X-GitHub-Event header")
+	}
+
+	var installation struct {
+		Installation struct {
+			ID int64 `json:"id"`
+		} `json:"installation"`
+	}
+	if err := json.Unmarshal(payload, &installation); err != nil {
+		return nil, fmt.Errorf("could not decode webhook payload: %s", err)
+	}
+	event.InstallationID = installation.Installation.ID
+	return event, nil
+}
+
+// ValidateSignature returns nil if signature, the value of a webhook's
+// X-Hub-Signature-256 header, is the HMAC-SHA256 of payload using the webhook
+// secret. ErrEmptySecret is returned if secret is empty.
+func ValidateSignature(signature string, payload, secret []byte) error {
+	return sig.Validate(signature, payload, secret)
+}
+
+// ParsePayload decodes the event's payload into the go-github event type for
+// its Type, such as *github.PushEvent for "push".
+func (e *Event) ParsePayload() (interface{}, error) {
+	return github.ParseWebHook(e.Type, e.Payload)
+}
+
+// Token returns an access token from ts for the installation the event was
+// delivered for, restricted by opts if it's non-nil. ErrNoInstallation is
+// returned if the event has no installation.
+func (e *Event) Token(ctx context.Context, ts ghinstallation.TokenSource, opts *github.InstallationTokenOptions) (*ghinstallation.AccessToken, error) {
+	if e.InstallationID == 0 {
+		return nil, ErrNoInstallation
+	}
+	return ts.Token(ctx, e.InstallationID, opts)
+}
@@ -0,0 +1,106 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v38/github"
+)
+
+var secret = []byte("It's a Secret to Everybody")
+
+// signature is GitHub's documented signature of "Hello, World!" using secret.
+const signature = "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+
+func TestValidateSignature(t *testing.T) {
+	tests := []struct {
+		signature string
+		payload   string
+		want      error
+	}{
+		{signature, "Hello, World!", nil},
+		{signature, "Hello, World?", ErrInvalidSignature},
+		{"", "Hello, World!", ErrMissingSignature},
+		{"sha1=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", "Hello, World!", ErrInvalidSignature},
+		{"sha256=not hex", "Hello, World!", ErrInvalidSignature},
+	}
+	for _, test := range tests {
+		if got := ValidateSignature(test.signature, []byte(test.payload), secret); got != test.want {
+			t.Errorf("ValidateSignature(%q, %q) = %v, want %v", test.signature, test.payload, got, test.want)
+		}
+	}
+	// Anyone can sign payloads with an empty secret.
+	mac := hmac.New(sha256.New, nil)
+	mac.Write([]byte("Hello, World!"))
+	forged := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := ValidateSignature(forged, []byte("Hello, World!"), nil); got != ErrEmptySecret {
+		t.Errorf("ValidateSignature() with empty secret = %v, want ErrEmptySecret", got)
+	}
+}
+
+type tokenSourceFunc func(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*ghinstallation.AccessToken, error)
+
+func (f tokenSourceFunc) Token(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*ghinstallation.AccessToken, error) {
+	return f(ctx, installationID, opts)
+}
+
+func TestParse(t *testing.T) {
+	payload := `{"action":"opened","issue":{"number":1},"installation":{"id":99}}`
+	r := httptest.NewRequest("POST", "/webhook", strings.NewReader(payload))
+	r.Header.Set("X-GitHub-Event", "issues")
+	r.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	r.Header.Set("X-Hub-Signature-256", "sha256=a9c3d85c5fc1c3b6aed4bc4d6e1ed27fcd5e72d4ac3acd4ea71e3c2c0e9e70e1")
+
+	if _, err := Parse(r, secret); err != ErrInvalidSignature {
+		t.Fatalf("Parse() with wrong signature err = %v, want ErrInvalidSignature", err)
+	}
+
+	r = httptest.NewRequest("POST", "/webhook", strings.NewReader(payload))
+	r.Header.Set("X-GitHub-Event", "issues")
+	r.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	r.Header.Set("X-Hub-Signature-256", sign(payload))
+	event, err := Parse(r, secret)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if event.Type != "issues" || event.DeliveryID != "72d3162e-cc78-11e3-81ab-4c9367dc0958" || event.InstallationID != 99 {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	parsed, err := event.ParsePayload()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if issue, ok := parsed.(*github.IssuesEvent); !ok || issue.GetIssue().GetNumber() != 1 {
+		t.Errorf("ParsePayload() = %#v, want *github.IssuesEvent", parsed)
+	}
+
+	ts := tokenSourceFunc(func(ctx context.Context, installationID int64, opts *github.InstallationTokenOptions) (*ghinstallation.AccessToken, error) {
+		if installationID != 99 {
+			t.Errorf("token requested for installation %v", installationID)
+		}
+		return &ghinstallation.AccessToken{Token: "abc123"}, nil
+	})
+	token, err := event.Token(context.Background(), ts, nil)
+	if err != nil || token.Token != "abc123" {
+		t.Errorf("Token() = %v, %v", token, err)
+	}
+
+	event.InstallationID = 0
+	if _, err := event.Token(context.Background(), ts, nil); !errors.Is(err, ErrNoInstallation) {
+		t.Errorf("Token() without installation err = %v, want ErrNoInstallation", err)
+	}
+}
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}